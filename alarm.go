@@ -0,0 +1,137 @@
+package openfand
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	AlarmStall     = "stall"
+	AlarmOverspeed = "overspeed"
+	AlarmErratic   = "erratic"
+)
+
+// alarmSettle is the duration after a speed change during which the tachometer is not checked for erratic readings.
+const alarmSettle = 5 * time.Second
+
+type alarmState int
+
+const (
+	alarmOK alarmState = iota
+	alarmPending
+	alarmRaised
+)
+
+// An alarm is raised once its condition held for a delay and cleared once the condition is absent for a recovery delay.
+type alarm struct {
+	state alarmState
+	first time.Time // First occurrence of the condition
+	last  time.Time // Last occurrence of the condition
+	hits  int
+}
+
+// update feeds the condition observed at now and returns true when the alarm is raised or cleared.
+// A pending alarm is reset once the condition is absent for grace.
+func (a *alarm) update(now time.Time, condition bool, delay, recovery, grace time.Duration, hits int) bool {
+	if condition {
+		if a.state == alarmOK {
+			a.state = alarmPending
+			a.first = now
+			a.hits = 0
+		}
+		a.last = now
+		a.hits++
+
+		if a.state == alarmPending && now.Sub(a.first) >= delay && a.hits >= hits {
+			a.state = alarmRaised
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case a.state == alarmPending && now.Sub(a.last) >= grace:
+		a.state = alarmOK
+	case a.state == alarmRaised && now.Sub(a.last) >= recovery:
+		a.state = alarmOK
+		return true
+	}
+
+	return false
+}
+
+// fanAlarms tracks the alarms of a fan.
+type fanAlarms struct {
+	alarms    map[string]*alarm
+	target    float64
+	changedAt time.Time
+}
+
+func newFanAlarms() *fanAlarms {
+	return &fanAlarms{
+		alarms: map[string]*alarm{
+			AlarmStall:     {},
+			AlarmOverspeed: {},
+			AlarmErratic:   {},
+		},
+	}
+}
+
+// check updates the alarms from the active evaluation of the fan and its new RPM reading.
+// It returns the raised or cleared alarms with their reason.
+func (f *fanAlarms) check(now time.Time, settings *FanAlarms, eval Evaluation, rpm uint16) map[string]string {
+	changes := map[string]string{}
+
+	if eval.Target() != f.target {
+		f.target = eval.Target()
+		f.changedAt = now
+	}
+
+	commanded := eval.PWM >= settings.stallPWM
+	if eval.Mode == ModeRPM {
+		commanded = eval.TargetRPM > 0
+	}
+	stalled := commanded && rpm <= settings.StallRPM
+	if f.alarms[AlarmStall].update(now, stalled, settings.Delay.Duration, settings.Delay.Duration, 0, 1) {
+		changes[AlarmStall] = fmt.Sprintf("%d RPM at %s", rpm, formatTarget(eval))
+	}
+
+	overspeed := settings.OverspeedRPM > 0 && rpm > settings.OverspeedRPM
+	if f.alarms[AlarmOverspeed].update(now, overspeed, settings.Delay.Duration, settings.Delay.Duration, 0, 1) {
+		changes[AlarmOverspeed] = fmt.Sprintf("%d RPM above %d RPM", rpm, settings.OverspeedRPM)
+	}
+
+	var erratic bool
+	if settings.erraticChange > 0 && eval.RPM > 0 && now.Sub(f.changedAt) >= alarmSettle {
+		change := math.Abs(float64(rpm)-float64(eval.RPM)) * 100 / float64(eval.RPM)
+		erratic = change > settings.erraticChange
+	}
+	// Raised on the count of erratic readings, cleared once they are absent for the delay.
+	if f.alarms[AlarmErratic].update(now, erratic, 0, settings.Delay.Duration, settings.Delay.Duration, settings.ErraticCount) {
+		changes[AlarmErratic] = fmt.Sprintf("%d RPM after %d RPM at %s", rpm, eval.RPM, formatTarget(eval))
+	}
+
+	return changes
+}
+
+// raised returns the sorted names of the raised alarms.
+func (f *fanAlarms) raised() []string {
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(f.alarms)) {
+		if f.alarms[name].state == alarmRaised {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func formatTarget(eval Evaluation) string {
+	if eval.Mode == ModeRPM {
+		return fmt.Sprintf("target %d RPM", eval.TargetRPM)
+	}
+	return fmt.Sprintf("PWM %.1f%%", eval.PWM)
+}
@@ -0,0 +1,122 @@
+package openfand
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAlarm(t *testing.T) {
+	type step struct {
+		at        int // Seconds
+		condition bool
+		changed   bool
+		state     alarmState
+	}
+
+	for name, tc := range map[string]struct {
+		delay, recovery, grace int // Seconds
+		hits                   int
+		steps                  []step
+	}{
+		"raise and clear": {delay: 10, recovery: 10, hits: 1, steps: []step{
+			{at: 0, condition: true, state: alarmPending},
+			{at: 5, condition: true, state: alarmPending},
+			{at: 10, condition: true, changed: true, state: alarmRaised},
+			{at: 15, state: alarmRaised},
+			{at: 19, state: alarmRaised},
+			{at: 20, changed: true, state: alarmOK}, // Absent for the recovery delay
+		}},
+		"reset without grace": {delay: 10, recovery: 10, hits: 1, steps: []step{
+			{at: 0, condition: true, state: alarmPending},
+			{at: 5, state: alarmOK},
+			{at: 6, condition: true, state: alarmPending},
+			{at: 10, condition: true, state: alarmPending}, // The delay starts over
+			{at: 16, condition: true, changed: true, state: alarmRaised},
+		}},
+		"grace": {delay: 10, recovery: 10, grace: 3, hits: 1, steps: []step{
+			{at: 0, condition: true, state: alarmPending},
+			{at: 2, state: alarmPending}, // Within the grace period
+			{at: 4, condition: true, state: alarmPending},
+			{at: 10, condition: true, changed: true, state: alarmRaised},
+		}},
+		"grace elapsed": {delay: 10, recovery: 10, grace: 3, hits: 1, steps: []step{
+			{at: 0, condition: true, state: alarmPending},
+			{at: 3, state: alarmOK},
+			{at: 4, condition: true, state: alarmPending},
+			{at: 10, condition: true, state: alarmPending},
+			{at: 14, condition: true, changed: true, state: alarmRaised},
+		}},
+		"hits": {recovery: 10, grace: 10, hits: 3, steps: []step{
+			{at: 0, condition: true, state: alarmPending},
+			{at: 1, state: alarmPending},
+			{at: 2, condition: true, state: alarmPending},
+			{at: 3, condition: true, changed: true, state: alarmRaised}, // Third hit
+			{at: 12, state: alarmRaised},
+			{at: 13, changed: true, state: alarmOK},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := &alarm{}
+			start := time.Unix(0, 0)
+			second := func(n int) time.Duration { return time.Duration(n) * time.Second }
+
+			for i, step := range tc.steps {
+				changed := a.update(start.Add(second(step.at)), step.condition, second(tc.delay), second(tc.recovery), second(tc.grace), tc.hits)
+				if changed != step.changed || a.state != step.state {
+					t.Errorf("step %d: %ds: got changed %v in state %d, want changed %v in state %d", i, step.at, changed, a.state, step.changed, step.state)
+				}
+			}
+		})
+	}
+}
+
+func TestFanAlarms(t *testing.T) {
+	settings := &FanAlarms{
+		Delay:         Duration{Duration: 10 * time.Second},
+		StallPWM:      "20%",
+		StallRPM:      100,
+		OverspeedRPM:  2000,
+		ErraticChange: "30%",
+		ErraticCount:  2,
+	}
+	if err := settings.parse(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFanAlarms()
+	start := time.Unix(0, 0)
+
+	for i, step := range []struct {
+		at      int     // Seconds
+		pwm     float64 // Active PWM
+		active  uint16  // Active RPM, the previous reading
+		rpm     uint16
+		changes []string
+		raised  []string
+	}{
+		{at: 0, pwm: 50, rpm: 0},
+		{at: 5, pwm: 50, rpm: 0},
+		{at: 10, pwm: 50, rpm: 0, changes: []string{AlarmStall}, raised: []string{AlarmStall}},
+		{at: 12, pwm: 10, rpm: 0, raised: []string{AlarmStall}}, // Not expected to spin below the stall_pwm
+		{at: 20, pwm: 10, rpm: 0, changes: []string{AlarmStall}},
+		{at: 21, pwm: 50, active: 1000, rpm: 500}, // Settling after the speed change
+		{at: 26, pwm: 50, active: 1000, rpm: 500},
+		{at: 27, pwm: 50, active: 500, rpm: 1000, changes: []string{AlarmErratic}, raised: []string{AlarmErratic}},
+		{at: 28, pwm: 50, active: 1000, rpm: 1000, raised: []string{AlarmErratic}},
+		{at: 37, pwm: 50, active: 1000, rpm: 1000, changes: []string{AlarmErratic}},
+		{at: 38, pwm: 50, active: 1000, rpm: 2500},
+		{at: 48, pwm: 50, active: 2500, rpm: 2500, changes: []string{AlarmOverspeed}, raised: []string{AlarmOverspeed}}, // The single erratic reading is forgotten
+	} {
+		eval := Evaluation{Mode: ModePWM, PWM: step.pwm, RPM: step.active}
+		changes := f.check(start.Add(time.Duration(step.at)*time.Second), settings, eval, step.rpm)
+
+		if got := slices.Sorted(maps.Keys(changes)); !slices.Equal(got, step.changes) {
+			t.Errorf("step %d: %ds: got changes %v, want %v", i, step.at, got, step.changes)
+		}
+		if got := f.raised(); !slices.Equal(got, step.raised) {
+			t.Errorf("step %d: %ds: got raised %v, want %v", i, step.at, got, step.raised)
+		}
+	}
+}
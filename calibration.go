@@ -0,0 +1,287 @@
+package openfand
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdouchement/logger"
+)
+
+// A Calibration is the PWM to RPM table measured on a fan.
+type Calibration struct {
+	Fan          string             `json:"fan"`
+	CalibratedAt time.Time          `json:"calibrated_at"`
+	Points       []CalibrationPoint `json:"points"`
+	MinStart     float64            `json:"min_start"` // Lowest PWM starting the fan from standstill
+	MinStop      float64            `json:"min_stop"`  // Lowest PWM keeping the fan spinning
+	MaxRPM       uint16             `json:"max_rpm"`
+}
+
+type CalibrationPoint struct {
+	PWM float64 `json:"pwm"`
+	RPM uint16  `json:"rpm"`
+}
+
+// CalibrationProgress is streamed by the calibration API, the last one holds the result or the error.
+type CalibrationProgress struct {
+	Point  *CalibrationPoint `json:"point,omitempty"`
+	Result *Calibration      `json:"result,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type CalibrationOptions struct {
+	Step   float64       // PWM step of the sweep in percent
+	Settle time.Duration // Duration to wait for the fan speed to settle after each step
+}
+
+// Floor returns the PWM applied instead of pwm so a spinning fan is never commanded below its start duty.
+// 0% still stops the fan.
+func (c Calibration) Floor(pwm float64) float64 {
+	if pwm == 0 {
+		return 0
+	}
+	return max(pwm, c.MinStart)
+}
+
+// Calibrate sweeps the PWM of the fan down from 100% until it stops, then up until it starts again.
+func Calibrate(ctx context.Context, controller OpenFan, ch Channel, tach *FanTach, opts CalibrationOptions, progress func(CalibrationPoint)) (Calibration, error) {
+	if opts.Step <= 0 || opts.Step > 100 {
+		opts.Step = 5
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 3 * time.Second
+	}
+
+	cal := Calibration{Fan: ch.String()}
+
+	measure := func(pwm float64, settle time.Duration) (CalibrationPoint, error) {
+		var p CalibrationPoint
+
+		applied, err := controller.SetPWM(ch.Fan, pwm)
+		if err != nil {
+			return p, fmt.Errorf("set pwm %.1f: %w", pwm, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-time.After(settle):
+		}
+
+		rpms, err := controller.RPMs()
+		if err != nil {
+			return p, fmt.Errorf("rpms: %w", err)
+		}
+
+		p = CalibrationPoint{PWM: applied, RPM: tach.RPM(rpms[ch.Fan])}
+		progress(p)
+		return p, nil
+	}
+
+	// Descending sweep, from full speed to standstill.
+	for i := 0; ; i++ {
+		pwm := max(100-float64(i)*opts.Step, 0)
+
+		settle := opts.Settle
+		if i == 0 {
+			settle *= 2 // Spin up from any speed
+		}
+
+		p, err := measure(pwm, settle)
+		if err != nil {
+			return cal, err
+		}
+
+		cal.Points = append(cal.Points, p)
+		cal.MaxRPM = max(cal.MaxRPM, p.RPM)
+		if p.RPM == 0 || pwm == 0 {
+			break
+		}
+		cal.MinStop = p.PWM
+	}
+
+	if cal.MaxRPM == 0 {
+		return cal, errors.New("the fan did not spin at 100%")
+	}
+
+	if last := cal.Points[len(cal.Points)-1]; last.RPM > 0 {
+		// The fan does not stop at 0%.
+		cal.MinStop = 0
+		cal.MinStart = 0
+	} else {
+		// Ascending sweep, from standstill until the fan starts.
+		cal.MinStart = 100
+		for pwm := opts.Step; pwm <= 100; pwm += opts.Step {
+			p, err := measure(pwm, opts.Settle)
+			if err != nil {
+				return cal, err
+			}
+
+			if p.RPM > 0 {
+				cal.MinStart = p.PWM
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(cal.Points, func(a, b CalibrationPoint) int {
+		return cmp.Compare(a.PWM, b.PWM)
+	})
+	cal.CalibratedAt = time.Now()
+
+	return cal, nil
+}
+
+// LoadCalibrations reads the calibrations stored in the state file, a missing file has no calibration.
+func LoadCalibrations(path string) (map[string]Calibration, error) {
+	calibrations := map[string]Calibration{}
+
+	p, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return calibrations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(p, &calibrations)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return calibrations, nil
+}
+
+// SaveCalibrations writes the calibrations in the state file.
+func SaveCalibrations(path string, calibrations map[string]Calibration) error {
+	p, err := json.MarshalIndent(calibrations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, p, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// calibrate runs the calibration of a fan and streams its progress as JSON lines.
+// The evaluation of the fan is suspended during the calibration.
+//
+//	POST /calibrate?fan=fan1[&step=5&settle=3s]
+func (c *Controller) calibrate(log logger.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		fid, err := ParseChannel(query.Get("fan"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("fan %q: %s", query.Get("fan"), err), http.StatusBadRequest)
+			return
+		}
+		fan, ok := c.fans[fid]
+		if !ok {
+			http.Error(w, fmt.Sprintf("%s not found in fan_settings", fid), http.StatusNotFound)
+			return
+		}
+
+		var opts CalibrationOptions
+		if query.Has("step") {
+			opts.Step, err = strconv.ParseFloat(strings.TrimSuffix(query.Get("step"), "%"), 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid step %s", query.Get("step")), http.StatusBadRequest)
+				return
+			}
+		}
+		if query.Has("settle") {
+			opts.Settle, err = time.ParseDuration(query.Get("settle"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid settle %s", query.Get("settle")), http.StatusBadRequest)
+				return
+			}
+		}
+
+		c.sync.Lock()
+		if _, ok := c.calibrating[fid]; ok {
+			c.sync.Unlock()
+			http.Error(w, fmt.Sprintf("%s is already being calibrated", fid), http.StatusConflict)
+			return
+		}
+		c.calibrating[fid] = true
+		c.sync.Unlock()
+
+		log.Infof("Calibrating %s(%s)", fid, fan.Label)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		rc := http.NewResponseController(w)
+		codec := json.NewEncoder(w)
+		send := func(p CalibrationProgress) {
+			if err := codec.Encode(p); err != nil {
+				log.WithError(err).Error("Could not write calibration progress")
+				return
+			}
+			rc.Flush()
+		}
+
+		cal, err := Calibrate(r.Context(), c.controllers[fid.Controller], fid, fan.Tach, opts, func(p CalibrationPoint) {
+			log.Infof("Calibrating %s(%s): PWM %.1f - %d RPM", fid, fan.Label, p.PWM, p.RPM)
+			send(CalibrationProgress{Point: &p})
+		})
+
+		c.sync.Lock()
+		c.calibrating[fid] = false // Released, the evaluation restores its PWM
+		if err == nil {
+			calibrations := maps.Clone(c.calibrations)
+			calibrations[fid] = cal
+			c.calibrations = calibrations
+		}
+		c.sync.Unlock()
+
+		if err != nil {
+			log.WithError(err).Errorf("Could not calibrate %s", fid)
+			send(CalibrationProgress{Error: err.Error()})
+			return
+		}
+
+		if err = c.saveCalibrations(); err != nil {
+			log.WithError(err).Errorf("Could not save calibration of %s", fid)
+			send(CalibrationProgress{Error: fmt.Sprintf("state: %s", err)})
+			return
+		}
+
+		log.Infof("Calibrated %s(%s): start %.1f%% - stop %.1f%% - max %d RPM", fid, fan.Label, cal.MinStart, cal.MinStop, cal.MaxRPM)
+		send(CalibrationProgress{Result: &cal})
+	}
+}
+
+// saveCalibrations writes the calibrations in the state file.
+func (c *Controller) saveCalibrations() error {
+	c.stateSync.Lock()
+	defer c.stateSync.Unlock()
+
+	c.sync.Lock()
+	state := map[string]Calibration{}
+	for ch, cal := range c.calibrations {
+		state[ch.String()] = cal
+	}
+	c.sync.Unlock()
+
+	return SaveCalibrations(c.stateFile, state)
+}
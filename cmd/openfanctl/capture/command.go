@@ -0,0 +1,49 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	return &cobra.Command{
+		Use:   "capture <file>",
+		Short: "Pretty-print a serial traffic capture",
+		Args:  cobra.ExactArgs(1),
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			return nil // No need to reach openfand
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			records, err := openfan.ReadCapture(f)
+			if err != nil {
+				return err
+			}
+
+			for i, record := range records {
+				var elapsed string
+				if i > 0 {
+					elapsed = "+" + record.Time.Sub(records[i-1].Time).String()
+				}
+
+				arrow := ">>"
+				if record.Direction == openfan.DirectionResponse {
+					arrow = "<<"
+				}
+
+				fmt.Printf("%s %12s %s %s\n", record.Time.Format("15:04:05.000000"), elapsed, arrow, strconv.Quote(record.Data))
+			}
+
+			return nil
+		},
+	}
+}
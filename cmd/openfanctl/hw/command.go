@@ -0,0 +1,197 @@
+package hw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mdouchement/openfand"
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/spf13/cobra"
+)
+
+const dangerousFlag = "i-know-what-im-doing"
+
+func Command(client *http.Client) *cobra.Command {
+	var controller string
+
+	cmd := &cobra.Command{
+		Use:   "hw",
+		Short: "Inspect the hardware of the controllers through openfand",
+	}
+	cmd.PersistentFlags().StringVar(&controller, "controller", "", "Name of the controller (can be omitted when openfand drives only one controller)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "info",
+		Short: "Print the hardware and firmware info of the controllers",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			var reports []openfand.HardwareReport
+			err := request(client, http.MethodGet, "/hardware", nil, &reports)
+			if err != nil {
+				return err
+			}
+
+			for _, report := range reports {
+				if controller != "" && report.Controller != controller {
+					continue
+				}
+
+				fmt.Println("Controller", report.Controller)
+				if report.Error != "" {
+					fmt.Println("  Error:", report.Error)
+					continue
+				}
+
+				fmt.Println("  HW_REV:", report.Hardware.Revision)
+				fmt.Println("  MCU:", report.Hardware.MCU)
+				fmt.Println("  USB:", report.Hardware.USB)
+				fmt.Println("  FAN_CHANNELS_TOTAL:", report.Hardware.FanChannelsTotal)
+				fmt.Println("  FAN_CHANNELS_ARCH:", report.Hardware.FanChannelsArch)
+				fmt.Println("  FAN_CHANNELS_DRIVER:", report.Hardware.FanChannelsDriver)
+				fmt.Println("  FW_REV:", report.Firmware.Revision)
+				fmt.Println("  PROTOCOL_VERSION:", report.Firmware.ProtocolVersion)
+			}
+
+			return nil
+		},
+	})
+
+	//
+	//
+	//
+
+	regs := &cobra.Command{
+		Use:   "regs",
+		Short: "Access the EMC2305 registers of a controller",
+	}
+	cmd.AddCommand(regs)
+
+	var chip int
+	dump := &cobra.Command{
+		Use:   "dump",
+		Short: "Print every EMC2305 register with its decoded fields",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			params := url.Values{}
+			params.Set("controller", controller)
+			if c.Flags().Changed("chip") {
+				params.Set("chip", strconv.Itoa(chip))
+			}
+
+			var values []openfand.RegisterValue
+			err := request(client, http.MethodGet, "/hardware/registers", params, &values)
+			if err != nil {
+				return err
+			}
+
+			printRegisters(values...)
+			return nil
+		},
+	}
+	dump.Flags().IntVar(&chip, "chip", 0, "Only dump the given EMC2305 (fan1-5 on chip 0, fan6-10 on chip 1)")
+	regs.AddCommand(dump)
+
+	var iknow bool
+
+	read := &cobra.Command{
+		Use:   "read <chip> <register>",
+		Short: "Read a raw register (address or name, e.g. 0x30 or FAN1_SETTING)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if !iknow {
+				return fmt.Errorf("raw register access requires --%s", dangerousFlag)
+			}
+
+			params := url.Values{}
+			params.Set("controller", controller)
+			params.Set("chip", args[0])
+			params.Set("register", args[1])
+
+			var value openfand.RegisterValue
+			err := request(client, http.MethodGet, "/hardware/register", params, &value)
+			if err != nil {
+				return err
+			}
+
+			printRegisters(value)
+			return nil
+		},
+	}
+	read.Flags().BoolVar(&iknow, dangerousFlag, false, "Acknowledge that raw register access can make the fans misbehave")
+	regs.AddCommand(read)
+
+	write := &cobra.Command{
+		Use:   "write <chip> <register> <value>",
+		Short: "Write a raw register (address or name, e.g. 0x30 or FAN1_SETTING)",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if !iknow {
+				return fmt.Errorf("raw register access requires --%s, a wrong value can stop the fans", dangerousFlag)
+			}
+
+			params := url.Values{}
+			params.Set("controller", controller)
+			params.Set("chip", args[0])
+			params.Set("register", args[1])
+			params.Set("value", args[2])
+
+			var value openfand.RegisterValue
+			err := request(client, http.MethodPut, "/hardware/register", params, &value)
+			if err != nil {
+				return err
+			}
+
+			printRegisters(value)
+			return nil
+		},
+	}
+	write.Flags().BoolVar(&iknow, dangerousFlag, false, "Acknowledge that a wrong value can stop the fans")
+	regs.AddCommand(write)
+
+	return cmd
+}
+
+func request(client *http.Client, method, path string, params url.Values, v any) error {
+	u := "http://unix" + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode == http.StatusNotFound {
+			return errors.New("openfand does not support hardware inspection, it may need to be upgraded")
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func printRegisters(values ...openfand.RegisterValue) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHIP\tADDR\tNAME\tVALUE\tFIELDS")
+	for _, v := range values {
+		fmt.Fprintf(w, "%d\t0x%02X\t%s\t0x%02X\t%s\n", v.Chip, v.Register, openfan.EMCRegisterName(v.Register), v.Value, strings.Join(openfan.DecodeEMCRegister(v.Register, v.Value), " "))
+	}
+	w.Flush()
+}
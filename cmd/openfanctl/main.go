@@ -12,6 +12,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/mdouchement/openfand/cmd/openfanctl/capture"
+	"github.com/mdouchement/openfand/cmd/openfanctl/hw"
 	"github.com/mdouchement/openfand/cmd/openfanctl/monitor"
 	"github.com/spf13/cobra"
 	"go.yaml.in/yaml/v4"
@@ -48,6 +50,8 @@ func main() {
 		},
 	}
 	cmd.AddCommand(monitor.Command(client))
+	cmd.AddCommand(capture.Command())
+	cmd.AddCommand(hw.Command(client))
 	cmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Version for openfand",
@@ -45,15 +45,15 @@ func Command(client *http.Client) *cobra.Command {
 						continue
 					}
 
-					var evals []openfand.Evaluation
-					err = json.Unmarshal(event, &evals)
+					var snapshot openfand.Snapshot
+					err = json.Unmarshal(event, &snapshot)
 					if err != nil {
 						tui.Quit()
 						fmt.Println("ERR:", err)
 						os.Exit(1)
 					}
 
-					tui.Send(evals)
+					tui.Send(snapshot)
 				}
 			}()
 
@@ -3,6 +3,8 @@ package monitor
 import (
 	"fmt"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,13 +13,19 @@ import (
 )
 
 type model struct {
-	table table.Model
+	height int
+	status string
+	table  table.Model
 }
 
 func newTUI() *model {
 	columns := []table.Column{
-		{Title: "Fans", Width: 20},
-		{Title: "Speeds", Width: 20},
+		{Title: "Fans", Width: 30},
+		{Title: "Speeds", Width: 18},
+		{Title: "Targets", Width: 16},
+		{Title: "Write failures", Width: 14},
+		{Title: "Alarms", Width: 24},
+		{Title: "Stop reasons", Width: 48},
 	}
 
 	t := table.New(
@@ -52,9 +60,10 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
+		m.height = msg.Height
 		m.table.SetWidth(msg.Width)
-		m.table.SetHeight(msg.Height)
-	case []openfand.Evaluation:
+		m.table.SetHeight(m.height - strings.Count(m.status, "\n"))
+	case openfand.Snapshot:
 		m.update(msg)
 	case tea.KeyMsg:
 		switch msg.String() {
@@ -67,14 +76,38 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) View() string {
-	return m.table.View()
+	return m.status + m.table.View()
 }
 
-func (m *model) update(evals []openfand.Evaluation) error {
+func (m *model) update(snapshot openfand.Snapshot) error {
+	var status strings.Builder
+	channels := map[string]int{}
+	for _, s := range snapshot.Controllers {
+		state := "connected"
+		if !s.Connected {
+			state = "disconnected"
+			if s.Error != "" {
+				state += ": " + s.Error
+			}
+		}
+		fmt.Fprintf(&status, "%s on %s - %d channels - %s - %d reconnections - last write %s\n", s.Name, s.Port, s.Channels, state, s.Reconnects, s.WriteLatency.Round(time.Millisecond))
+		channels[s.Name] = s.Channels
+	}
+	m.status = status.String()
+	if m.height > 0 {
+		m.table.SetHeight(m.height - len(snapshot.Controllers))
+	}
+
+	//
+
+	evals := snapshot.Evaluations
 	var n int
 	for _, eval := range evals {
-		if eval.PWM == 0 {
-			continue
+		if int(eval.ID) >= channels[eval.Controller] {
+			continue // Not a channel of the hardware
+		}
+		if eval.Label == "" && eval.RPM == 0 {
+			continue // Unused channel
 		}
 		evals[n] = eval
 		n++
@@ -84,17 +117,31 @@ func (m *model) update(evals []openfand.Evaluation) error {
 	//
 
 	slices.SortStableFunc(evals, func(a, b openfand.Evaluation) int {
-		if a.ID < b.ID {
-			return -1
-		}
-		return 1
+		return a.Channel().Compare(b.Channel())
 	})
 
 	rows := make([]table.Row, 0, len(evals))
 	for _, eval := range evals {
+		target := fmt.Sprintf("%5.1f%%", eval.PWM)
+		if eval.RampTarget != nil {
+			target += fmt.Sprintf(" → %5.1f%%", *eval.RampTarget)
+		}
+		if eval.Mode == openfand.ModeRPM {
+			target = fmt.Sprintf("%4d RPM", eval.TargetRPM)
+		}
+
+		speed := fmt.Sprintf("%4d RPM", eval.RPM)
+		if s := eval.Speed(); s >= 0 {
+			speed += fmt.Sprintf(" (%3.0f%%)", s)
+		}
+
 		rows = append(rows, table.Row{
-			fmt.Sprintf("fan%d(%s)", eval.ID+1, eval.Label),
-			fmt.Sprintf("%4d RPM (%2d%%)", eval.RPM, eval.PWM),
+			fmt.Sprintf("%s(%s)", eval.Channel(), eval.Label),
+			speed,
+			target,
+			fmt.Sprintf("%d", eval.WriteFailures),
+			strings.Join(eval.Alarms, ", "),
+			eval.Stopped,
 		})
 	}
 
@@ -0,0 +1,96 @@
+package calibrate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdouchement/openfand"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var cpath string
+	var step float64
+	var settle time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "calibrate <fanN>",
+		Short: "Measure the PWM to RPM table of a fan through the running openfand",
+		Long: "Sweep the PWM of a fan to find its start and stop duties and its maximum RPM.\n" +
+			"The result is saved in the state file and used as the minimum PWM of the fan.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			cfg, err := openfand.Load(cpath)
+			if err != nil {
+				return err
+			}
+
+			client := &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var d net.Dialer
+						return d.DialContext(ctx, "unix", cfg.Socket)
+					},
+				},
+			}
+
+			params := url.Values{}
+			params.Set("fan", args[0])
+			params.Set("step", strconv.FormatFloat(step, 'f', -1, 64))
+			params.Set("settle", settle.String())
+
+			resp, err := client.Post("http://unix/calibrate?"+params.Encode(), "", nil)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+				return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+			}
+
+			fmt.Println("Calibrating", args[0], "- this may take a few minutes")
+
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var progress openfand.CalibrationProgress
+				if err = json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+					return err
+				}
+
+				switch {
+				case progress.Point != nil:
+					fmt.Printf("  PWM %5.1f%% - %4d RPM\n", progress.Point.PWM, progress.Point.RPM)
+				case progress.Error != "":
+					return errors.New(progress.Error)
+				case progress.Result != nil:
+					fmt.Printf("Start: %.1f%%\n", progress.Result.MinStart)
+					fmt.Printf("Stop: %.1f%%\n", progress.Result.MinStop)
+					fmt.Printf("Max: %d RPM\n", progress.Result.MaxRPM)
+					return nil
+				}
+			}
+			if err = scanner.Err(); err != nil {
+				return err
+			}
+
+			return errors.New("calibration interrupted")
+		},
+	}
+	cmd.Flags().StringVarP(&cpath, "config", "c", "/etc/openfand/openfand.yml", "Configfile path")
+	cmd.Flags().Float64VarP(&step, "step", "s", 5, "PWM step of the sweep in percent")
+	cmd.Flags().DurationVarP(&settle, "settle", "", 3*time.Second, "Duration to wait for the fan speed to settle after each step")
+
+	return cmd
+}
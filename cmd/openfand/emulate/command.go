@@ -0,0 +1,119 @@
+package emulate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/mdouchement/openfand/openfan/emulator"
+	"github.com/mdouchement/openfand/openfan/firmware"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var link string
+	var listen string
+	var bootloader string
+	var opts emulator.Options
+
+	cmd := &cobra.Command{
+		Use:   "emulate",
+		Short: "Emulate an OpenFanController on a pseudo-terminal",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			var e *emulator.Emulator
+			opts.OnBootloader = func() {
+				if bootloader == "" {
+					fmt.Println("Jump to bootloader requested, exiting")
+					stop()
+					return
+				}
+
+				fmt.Printf("Jump to bootloader requested, waiting for an UF2 image in %s\n", filepath.Join(bootloader, firmware.BootloaderVolume))
+				go func() {
+					revision, err := e.MountBootloader(ctx, bootloader)
+					if err != nil {
+						fmt.Println("ERR:", err)
+						stop()
+						return
+					}
+					fmt.Println("Flashed firmware", revision)
+				}()
+			}
+
+			e = emulator.New(opts)
+
+			if listen != "" {
+				// Raw TCP serial server, like ser2net.
+				ln, err := net.Listen("tcp", listen)
+				if err != nil {
+					return err
+				}
+				defer ln.Close()
+
+				fmt.Printf("Emulating an OpenFan with %d channels on tcp://%s\n", opts.Channels, ln.Addr())
+
+				go func() {
+					for {
+						conn, err := ln.Accept()
+						if err != nil {
+							return
+						}
+
+						go func() {
+							defer conn.Close()
+							e.Serve(conn)
+						}()
+					}
+				}()
+
+				<-ctx.Done()
+				return nil
+			}
+
+			pty, err := emulator.OpenPTY()
+			if err != nil {
+				return err
+			}
+			defer pty.Close()
+
+			name := pty.Name()
+			if link != "" {
+				os.Remove(link)
+				if err = os.Symlink(name, link); err != nil {
+					return err
+				}
+				defer os.Remove(link)
+
+				name = link
+			}
+
+			fmt.Printf("Emulating an OpenFan with %d channels on %s\n", opts.Channels, name)
+
+			go func() {
+				if err := e.Serve(pty); err != nil {
+					fmt.Println("ERR:", err)
+				}
+				stop()
+			}()
+
+			<-ctx.Done()
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&link, "link", "l", "", "Symlink created to the pseudo-terminal (e.g. /tmp/openfan)")
+	cmd.Flags().StringVarP(&listen, "listen", "", "", "Serve the emulator over raw TCP instead of a pseudo-terminal (e.g. 127.0.0.1:2000)")
+	cmd.Flags().IntVarP(&opts.Channels, "channels", "n", 10, "Number of fan channels")
+	cmd.Flags().Float64VarP(&opts.MaxRPM, "max-rpm", "", 1500, "Speed of the fans at 100%")
+	cmd.Flags().DurationVarP(&opts.Inertia, "inertia", "", emulator.DefaultInertia, "Time constant of the fans' speed changes")
+	cmd.Flags().StringVarP(&bootloader, "bootloader-root", "", "", "Directory where the bootloader drive is emulated on jump to bootloader (the flashed revision is the image name)")
+	cmd.Flags().BoolVarP(&opts.Logs, "logs", "", false, "Send firmware log lines along with the responses")
+
+	return cmd
+}
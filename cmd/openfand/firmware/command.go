@@ -0,0 +1,153 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/openfan/firmware"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "firmware",
+		Short: "Manage the firmware of the OpenFanController",
+	}
+
+	var port string
+	var sn string
+	var root string
+	var revision string
+	var timeout time.Duration
+
+	flash := &cobra.Command{
+		Use:   "flash <file.uf2>",
+		Short: "Flash a firmware on the OpenFanController (openfand must be stopped)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			image, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			if err = firmware.ValidateUF2(image); err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+
+			ctrl, err := open(port, sn)
+			if err != nil {
+				return fmt.Errorf("openfan: %w", err)
+			}
+			sn = ctrl.SerialNumber()
+
+			fw, err := ctrl.FirmwareInfo()
+			if err != nil {
+				ctrl.Close()
+				return fmt.Errorf("openfan: %w", err)
+			}
+			fmt.Printf("Running firmware - REV: %s - PROTOCOL_VERSION: %s\n", fw.Revision, fw.ProtocolVersion)
+
+			if revision != "" && fw.Revision == revision {
+				ctrl.Close()
+				fmt.Println("Firmware", revision, "is already running")
+				return nil
+			}
+
+			fmt.Println("Jumping to bootloader")
+			if err = ctrl.JumpToBootLoader(); err != nil {
+				ctrl.Close()
+				return fmt.Errorf("openfan: %w", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			mount, err := firmware.WaitBootloader(ctx, root)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Copying", args[0], "to", mount)
+			if err = firmware.Install(mount, args[0], image); err != nil {
+				return err
+			}
+
+			fmt.Println("Waiting for the device to restart")
+			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			nfw, err := waitFirmware(ctx, port, sn)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Running firmware - REV: %s - PROTOCOL_VERSION: %s\n", nfw.Revision, nfw.ProtocolVersion)
+
+			if revision != "" && nfw.Revision != revision {
+				return fmt.Errorf("firmware revision is %s instead of %s", nfw.Revision, revision)
+			}
+			if nfw.Revision == fw.Revision {
+				fmt.Println("WARN: the firmware revision did not change")
+			}
+
+			return nil
+		},
+	}
+	flash.Flags().StringVarP(&port, "port", "p", "", "Serial port of the device (default auto-detected)")
+	flash.Flags().StringVarP(&sn, "serial-number", "s", "", "USB serial number of the device, required when several devices are plugged")
+	flash.Flags().StringVarP(&root, "mount-root", "", "/media", "Directory where the bootloader drive is mounted (e.g. /run/media)")
+	flash.Flags().StringVarP(&revision, "revision", "r", "", "Expected FW_REV of the flashed firmware")
+	flash.Flags().DurationVarP(&timeout, "timeout", "", 30*time.Second, "Maximum duration to wait for the bootloader and the restart of the device")
+	cmd.AddCommand(flash)
+
+	return cmd
+}
+
+func open(port, sn string) (*openfan.Controller, error) {
+	switch {
+	case port != "":
+		return openfan.Open(port)
+	case sn != "":
+		return openfan.OpenSerialNumber(sn)
+	}
+
+	devices, err := openfan.Discover()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) > 1 {
+		return nil, errors.New("several devices are plugged, one must be selected with --serial-number")
+	}
+
+	return openfan.OpenAuto()
+}
+
+// waitFirmware waits for the device to be re-enumerated and returns its firmware info.
+func waitFirmware(ctx context.Context, port, sn string) (*openfan.FirmwareInfo, error) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("device did not restart: %w", errors.Join(ctx.Err(), err))
+		case <-ticker.C:
+		}
+
+		var ctrl *openfan.Controller
+		ctrl, err = open(port, sn)
+		if err != nil {
+			continue
+		}
+
+		var fw *openfan.FirmwareInfo
+		fw, err = ctrl.FirmwareInfo()
+		ctrl.Close()
+		if err == nil {
+			return fw, nil
+		}
+	}
+}
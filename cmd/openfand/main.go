@@ -1,12 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
 	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"slices"
@@ -15,10 +17,16 @@ import (
 
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/openfand"
+	"github.com/mdouchement/openfand/cmd/openfand/calibrate"
+	"github.com/mdouchement/openfand/cmd/openfand/emulate"
+	"github.com/mdouchement/openfand/cmd/openfand/firmware"
 	showcurves "github.com/mdouchement/openfand/cmd/openfand/show_curves"
+	showdevices "github.com/mdouchement/openfand/cmd/openfand/show_devices"
 	showsensors "github.com/mdouchement/openfand/cmd/openfand/show_sensors"
+	"github.com/mdouchement/openfand/hwmon/fan"
 	"github.com/mdouchement/openfand/hwmon/sensor"
 	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/remote"
 	"github.com/spf13/cobra"
 )
 
@@ -27,8 +35,10 @@ var (
 	revision = "none"
 	date     = "unknown"
 
-	cpath string
-	dummy bool
+	cpath         string
+	dummy         bool
+	dummyChannels int
+	capture       string
 )
 
 func main() {
@@ -41,7 +51,13 @@ func main() {
 	}
 	cmd.Flags().StringVarP(&cpath, "config", "c", "/etc/openfand/openfand.yml", "Configfile path")
 	cmd.Flags().BoolVarP(&dummy, "dummy", "", false, "Start openfand with a dummy openfan controller")
+	cmd.Flags().IntVarP(&dummyChannels, "dummy-channels", "", 10, "Number of channels of the dummy openfan controller")
+	cmd.Flags().StringVarP(&capture, "capture", "", "", "Directory where the serial traffic of each controller is captured")
+	cmd.AddCommand(calibrate.Command())
+	cmd.AddCommand(emulate.Command())
+	cmd.AddCommand(firmware.Command())
 	cmd.AddCommand(showcurves.Command())
+	cmd.AddCommand(showdevices.Command())
 	cmd.AddCommand(showsensors.Command())
 	cmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -83,35 +99,103 @@ func daemon(_ *cobra.Command, args []string) error {
 
 	log.Infof("openfand version %s", version)
 
-	var fan openfand.OpenFan = openfand.NewDummyOpenfanController()
-	if !dummy {
-		ctrl, err := openfan.OpenAuto()
+	controllers := map[string]openfand.OpenFan{}
+	if dummy {
+		controllers[openfand.DefaultController] = openfand.NewDummyOpenfanController(dummyChannels)
+		for name := range cfg.Controllers {
+			controllers[name] = openfand.NewDummyOpenfanController(dummyChannels)
+		}
+	} else {
+		ctrls, err := openControllers(cfg)
 		if err != nil {
 			return fmt.Errorf("openfan: %w", err)
 		}
-		if cfg.Debug {
-			ctrl.SetLogger(log)
-		}
 
-		{
-			log.Infof("Fan Controller port `%s`", ctrl.Port())
+		for name, ctrl := range ctrls {
+			defer ctrl.Close()
+
+			if cfg.Debug {
+				ctrl.SetLogger(log)
+			}
+
+			if capture != "" {
+				f, err := os.Create(filepath.Join(capture, name+".jsonl"))
+				if err != nil {
+					return fmt.Errorf("capture: %w", err)
+				}
+				defer f.Close()
+
+				ctrl.SetCapture(openfan.NewRecorder(f))
+			}
+
+			log.Infof("Fan Controller %s port `%s` - SN: %s", name, ctrl.Port(), ctrl.SerialNumber())
 
 			hw, err := ctrl.HardwareInfo()
 			if err != nil {
-				panic(err)
+				return fmt.Errorf("openfan: %s: %w", name, err)
 			}
 			log.Infof("Hardware - REV: %s - MCU: %s - USB: %s - FAN_CHANNELS_TOTAL: %s - FAN_CHANNELS_ARCH: %s - FAN_CHANNELS_DRIVER: %s",
 				hw.Revision, hw.MCU, hw.USB, hw.FanChannelsTotal, hw.FanChannelsArch, hw.FanChannelsDriver)
 
 			fw, err := ctrl.FirmwareInfo()
 			if err != nil {
-				panic(err)
+				return fmt.Errorf("openfan: %s: %w", name, err)
 			}
 			log.Infof("Firmware - REV: %s - PROTOCOL_VERSION: %s", fw.Revision, fw.ProtocolVersion)
+
+			controllers[name] = ctrl
 		}
 
-		defer ctrl.Close()
-		fan = ctrl
+		for _, name := range slices.Sorted(maps.Keys(cfg.Controllers)) {
+			settings := cfg.Controllers[name]
+			if settings.Type != openfand.ControllerHTTP {
+				continue
+			}
+
+			ctrl, err := remote.New(remote.Options{
+				URL:      settings.HTTP.URL,
+				Channels: settings.HTTP.Channels,
+				Timeout:  settings.HTTP.Timeout.Duration,
+				Retries:  settings.HTTP.Retries,
+				Headers:  settings.HTTP.Headers,
+				RPMsPath: settings.HTTP.RPMsPath,
+				PWMPath:  settings.HTTP.PWMPath,
+				RPMPath:  settings.HTTP.RPMPath,
+			})
+			if err != nil {
+				return fmt.Errorf("http: %s: %w", name, err)
+			}
+
+			n, err := ctrl.Channels()
+			if err != nil {
+				return fmt.Errorf("http: %s: %w", name, err)
+			}
+			log.Infof("Fan Controller %s url `%s` - %d channels", name, ctrl.Port(), n)
+
+			controllers[name] = ctrl
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(cfg.Controllers)) {
+			settings := cfg.Controllers[name]
+			if settings.Type != openfand.ControllerHWMon {
+				continue
+			}
+
+			ctrl, err := fan.Open(settings.HWMon)
+			if err != nil {
+				return fmt.Errorf("hwmon: %s: %w", name, err)
+			}
+			defer func() {
+				if err := ctrl.Close(); err != nil {
+					log.WithError(err).Errorf("Could not restore pwm_enable of %s", name)
+				}
+			}()
+
+			n, _ := ctrl.Channels()
+			log.Infof("Fan Controller %s hwmon `%s` - %d PWM channels", name, ctrl.Port(), n)
+
+			controllers[name] = ctrl
+		}
 	}
 
 	collector, err := sensor.New()
@@ -125,14 +209,15 @@ func daemon(_ *cobra.Command, args []string) error {
 		return err
 	}
 
-	shaper, err := openfand.NewCurveShaper(cfg, temps)
+	curves, err := openfand.NewCurveShaper(cfg, temps)
 	if err != nil {
 		return err
 	}
+	shaper := openfand.NewZeroRPMShaper(cfg, openfand.NewPIDShaper(cfg, openfand.NewHysteresisShaper(cfg, curves), time.Now), time.Now)
 
 	ctx, cancel := context.WithCancel(ctx)
 
-	controler, err := openfand.New(cfg, fan, collector, shaper, 500*time.Millisecond)
+	controler, err := openfand.New(cfg, controllers, collector, shaper, 500*time.Millisecond)
 	if err != nil {
 		cancel()
 		return err
@@ -149,6 +234,72 @@ func daemon(_ *cobra.Command, args []string) error {
 	return nil
 }
 
+// openControllers opens the OpenFan devices listed in the config, the one pinned by the device section
+// or all the plugged ones if none are listed.
+func openControllers(cfg openfand.Config) (map[string]*openfan.Controller, error) {
+	controllers := map[string]*openfan.Controller{}
+	closeAll := func() {
+		for _, ctrl := range controllers {
+			ctrl.Close()
+		}
+	}
+
+	if len(cfg.Controllers) > 0 {
+		for _, name := range slices.Sorted(maps.Keys(cfg.Controllers)) {
+			if cfg.Controllers[name].Type != openfand.ControllerOpenFan {
+				continue
+			}
+
+			ctrl, err := openfan.OpenConfig(cfg.Controllers[name].Device.OpenFan())
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			controllers[name] = ctrl
+		}
+
+		return controllers, nil
+	}
+
+	if cfg.Device.SerialNumber != "" || cfg.Device.Port != "" {
+		ctrl, err := openfan.OpenConfig(cfg.Device.OpenFan())
+		if err != nil {
+			return nil, err
+		}
+
+		controllers[openfand.DefaultController] = ctrl
+		return controllers, nil
+	}
+
+	device := cfg.Device.OpenFan()
+	devices, err := openfan.DiscoverUSB(cmp.Or(device.VID, openfan.DefaultVID), cmp.Or(device.PID, openfan.DefaultPID))
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, openfan.ErrNotFound
+	}
+
+	for _, d := range devices {
+		device.SerialNumber = d.SerialNumber
+
+		ctrl, err := openfan.OpenConfig(device)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", d.SerialNumber, err)
+		}
+
+		name := d.SerialNumber
+		if len(devices) == 1 {
+			name = openfand.DefaultController
+		}
+		controllers[name] = ctrl
+	}
+
+	return controllers, nil
+}
+
 func trimCollector(cfg openfand.Config, collector *sensor.Collector) ([]sensor.Temperature, error) {
 	temps, err := collector.Temperatures()
 	if err != nil {
@@ -162,6 +313,14 @@ func trimCollector(cfg openfand.Config, collector *sensor.Collector) ([]sensor.T
 	}
 
 	for _, fan := range cfg.FanSettings {
+		if fan.PID != nil {
+			if !exists[fan.PID.Sensor] {
+				return nil, fmt.Errorf("not found: %s", strconv.Quote(fan.PID.Sensor))
+			}
+
+			delete(unwanted, fan.PID.Sensor)
+		}
+
 		for _, point := range fan.CurvePoints {
 			for _, thresholds := range point {
 				for name := range thresholds {
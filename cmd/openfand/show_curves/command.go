@@ -6,6 +6,7 @@ import (
 	"image"
 	_ "image/png"
 	"maps"
+	"math"
 	"os"
 	"slices"
 	"strconv"
@@ -14,7 +15,6 @@ import (
 	"github.com/mattn/go-sixel"
 	"github.com/mdouchement/openfand"
 	"github.com/mdouchement/openfand/hwmon/sensor"
-	"github.com/mdouchement/openfand/openfan"
 	"github.com/spf13/cobra"
 )
 
@@ -49,15 +49,17 @@ func Command() *cobra.Command {
 			}
 
 			var maxT int
-			labels := map[openfan.Fan]string{}
+			labels := map[openfand.Channel]string{}
+			modes := map[openfand.Channel]string{}
 			probes := map[string]sensor.TemperatureID{}
 			for _, fan := range cfg.FanSettings {
-				labels[fan.ID] = fan.Label
+				labels[fan.Channel()] = fan.Label
+				modes[fan.Channel()] = fan.Mode
 
 				for _, p := range fan.CurvePoints {
 					for _, thresholds := range p {
 						for tname, v := range thresholds {
-							maxT = max(maxT, v)
+							maxT = max(maxT, int(math.Ceil(v)))
 							if _, ok := probes[tname]; !ok {
 								for _, t := range temps {
 									if t.Name == tname {
@@ -77,7 +79,7 @@ func Command() *cobra.Command {
 			// Compute points
 			//
 
-			m := make(map[openfan.Fan]map[sensor.TemperatureID]charts.LineSeries)
+			m := make(map[openfand.Channel]map[sensor.TemperatureID]charts.LineSeries)
 			decimals := 100 // HWMON can return 42.321°C
 
 			for probe, tid := range probes {
@@ -91,19 +93,19 @@ func Command() *cobra.Command {
 							},
 						}
 
-						for _, eval := range shaper.Eval(temps) {
-							if _, ok := m[eval.ID]; !ok {
-								m[eval.ID] = make(map[sensor.TemperatureID]charts.LineSeries)
+						for fid, eval := range shaper.Eval(temps) {
+							if _, ok := m[fid]; !ok {
+								m[fid] = make(map[sensor.TemperatureID]charts.LineSeries)
 							}
-							if _, ok := m[eval.ID][eval.TemperatureID]; !ok {
-								m[eval.ID][eval.TemperatureID] = charts.LineSeries{
+							if _, ok := m[fid][eval.TemperatureID]; !ok {
+								m[fid][eval.TemperatureID] = charts.LineSeries{
 									Name: eval.TemperatureName,
 								}
 							}
 
-							ls := m[eval.ID][eval.TemperatureID]
-							ls.Values = append(ls.Values, float64(eval.PWM))
-							m[eval.ID][eval.TemperatureID] = ls
+							ls := m[fid][eval.TemperatureID]
+							ls.Values = append(ls.Values, float64(eval.Target()))
+							m[fid][eval.TemperatureID] = ls
 						}
 					}
 				}
@@ -113,7 +115,7 @@ func Command() *cobra.Command {
 			// Render charts
 			//
 
-			for _, fid := range slices.Sorted(maps.Keys(m)) {
+			for _, fid := range slices.SortedFunc(maps.Keys(m), openfand.Channel.Compare) {
 				fm := m[fid]
 
 				var set charts.LineSeriesList
@@ -124,7 +126,7 @@ func Command() *cobra.Command {
 				opt := charts.NewLineChartOptionWithSeries(set)
 				opt.Theme = charts.GetTheme(charts.ThemeVividDark)
 				opt.Padding = charts.NewBox(20, 20, 20, 20)
-				opt.Title.Text = fmt.Sprintf("fan%d: %s", fid+1, labels[fid])
+				opt.Title.Text = fmt.Sprintf("%s: %s", fid, labels[fid])
 				opt.Title.FontStyle.FontSize = 16
 				opt.Title.Offset = charts.OffsetLeft
 				opt.Legend = charts.LegendOption{
@@ -157,6 +159,11 @@ func Command() *cobra.Command {
 						Unit:                   10,
 					},
 				}
+				if modes[fid] == openfand.ModeRPM {
+					opt.YAxis[0].Title = "RPM"
+					opt.YAxis[0].Max = nil
+					opt.YAxis[0].Unit = 0
+				}
 				p := charts.NewPainter(charts.PainterOptions{
 					OutputFormat: charts.ChartOutputPNG,
 					Width:        resolution,
@@ -165,23 +172,23 @@ func Command() *cobra.Command {
 
 				err := p.LineChart(opt)
 				if err != nil {
-					return fmt.Errorf("fan%d: %w", fid+1, err)
+					return fmt.Errorf("%s: %w", fid, err)
 				}
 
 				mPNG, err := p.Bytes()
 				if err != nil {
-					return fmt.Errorf("fan%d: %w", fid+1, err)
+					return fmt.Errorf("%s: %w", fid, err)
 				}
 
 				m, _, err := image.Decode(bytes.NewReader(mPNG))
 				if err != nil {
-					return fmt.Errorf("fan%d: %w", fid+1, err)
+					return fmt.Errorf("%s: %w", fid, err)
 				}
 
 				codec := sixel.NewEncoder(os.Stdout)
 				err = codec.Encode(m)
 				if err != nil {
-					return fmt.Errorf("fan%d: %w", fid+1, err)
+					return fmt.Errorf("%s: %w", fid, err)
 				}
 			}
 
@@ -0,0 +1,49 @@
+package showdevices
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/spf13/cobra"
+)
+
+func Command() *cobra.Command {
+	var vid string
+	var pid string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "show-devices",
+		Short: "Show the plugged OpenFan devices usable in the config file",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if all {
+				vid, pid = "", ""
+			}
+
+			devices, err := openfan.DiscoverUSB(vid, pid)
+			if err != nil {
+				return err
+			}
+
+			if len(devices) == 0 {
+				fmt.Println("No device found")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SERIAL_NUMBER\tVID:PID\tPORT\tBY-ID")
+			for _, d := range devices {
+				fmt.Fprintf(w, "%s\t%s:%s\t%s\t%s\n", d.SerialNumber, d.VID, d.PID, d.Port, d.ByID)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&vid, "vid", "", openfan.DefaultVID, "USB vendor ID of the devices")
+	cmd.Flags().StringVarP(&pid, "pid", "", openfan.DefaultPID, "USB product ID of the devices")
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Show all the USB serial devices")
+
+	return cmd
+}
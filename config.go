@@ -1,29 +1,497 @@
 package openfand
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mdouchement/openfand/openfan"
 	"go.yaml.in/yaml/v4"
 )
 
 type Config struct {
-	Debug       bool            `yaml:"debug"`
-	Socket      string          `yaml:"socket"`
-	FanSettings map[string]*Fan `yaml:"fan_settings"`
+	Debug     bool   `yaml:"debug"`
+	Socket    string `yaml:"socket"`
+	StateFile string `yaml:"state_file"`
+	// RegisterWrites allows the raw EMC2305 register writes of `openfanctl hw regs write`.
+	RegisterWrites bool                           `yaml:"register_writes"`
+	Device         DeviceSettings                 `yaml:"device"`
+	Controllers    map[string]*ControllerSettings `yaml:"controllers"`
+	FanSettings    map[string]*Fan                `yaml:"fan_settings"`
 }
 
+type ControllerSettings struct {
+	Name   string         `yaml:"-"`
+	Type   string         `yaml:"type"`
+	Device DeviceSettings `yaml:",inline"`
+	HWMon  string         `yaml:"hwmon"`
+	HTTP   *HTTPSettings  `yaml:"http"`
+}
+
+// DeviceSettings selects an OpenFan device and configures its serial port.
+type DeviceSettings struct {
+	SerialNumber string   `yaml:"serial_number"`
+	Port         string   `yaml:"port"` // e.g. /dev/ttyACM0, /dev/serial/by-id/..., tcp://host:port or rfc2217://host:port
+	VID          string   `yaml:"vid"`
+	PID          string   `yaml:"pid"`
+	BaudRate     int      `yaml:"baud_rate"`
+	ReadTimeout  Duration `yaml:"read_timeout"`
+}
+
+// OpenFan returns the openfan configuration of the device.
+func (d DeviceSettings) OpenFan() openfan.DeviceConfig {
+	return openfan.DeviceConfig{
+		SerialNumber: d.SerialNumber,
+		Port:         d.Port,
+		VID:          d.VID,
+		PID:          d.PID,
+		BaudRate:     d.BaudRate,
+		ReadTimeout:  d.ReadTimeout.Duration,
+	}
+}
+
+func (d DeviceSettings) validate() error {
+	if d.SerialNumber != "" && d.Port != "" {
+		return fmt.Errorf("serial_number and port are mutually exclusive")
+	}
+
+	reID := regexp.MustCompile(`^[0-9a-fA-F]{4}$`)
+	if d.VID != "" && !reID.MatchString(d.VID) {
+		return fmt.Errorf("invalid vid %s", d.VID)
+	}
+	if d.PID != "" && !reID.MatchString(d.PID) {
+		return fmt.Errorf("invalid pid %s", d.PID)
+	}
+	if d.BaudRate < 0 {
+		return fmt.Errorf("invalid baud_rate %d", d.BaudRate)
+	}
+	if d.ReadTimeout.Duration < 0 {
+		return fmt.Errorf("invalid read_timeout %s", d.ReadTimeout.Duration)
+	}
+
+	return nil
+}
+
+// inherit fills the unset serial port settings with the ones of o.
+func (d DeviceSettings) inherit(o DeviceSettings) DeviceSettings {
+	if d.VID == "" {
+		d.VID = o.VID
+	}
+	if d.PID == "" {
+		d.PID = o.PID
+	}
+	if d.BaudRate == 0 {
+		d.BaudRate = o.BaudRate
+	}
+	if d.ReadTimeout.Duration == 0 {
+		d.ReadTimeout = o.ReadTimeout
+	}
+	return d
+}
+
+type HTTPSettings struct {
+	URL      string            `yaml:"url"`
+	Channels int               `yaml:"channels"` // Read from the RPMs endpoint when not set
+	Timeout  Duration          `yaml:"timeout"`
+	Retries  int               `yaml:"retries"`
+	Headers  map[string]string `yaml:"headers"` // Environment variables are expanded (e.g. `Bearer ${OPENFAN_TOKEN}`)
+	RPMsPath string            `yaml:"rpms_path"`
+	PWMPath  string            `yaml:"pwm_path"`
+	RPMPath  string            `yaml:"rpm_path"`
+}
+
+const (
+	ControllerOpenFan = "openfan"
+	ControllerHWMon   = "hwmon"
+	ControllerHTTP    = "http"
+)
+
+// DefaultStateFile stores the fan calibrations.
+const DefaultStateFile = "/var/lib/openfand/state.json"
+
+const (
+	ModePWM = "pwm"
+	ModeRPM = "rpm"
+)
+
+const (
+	ControlCurve = "curve"
+	ControlPID   = "pid"
+)
+
 type Fan struct {
-	ID              openfan.Fan                 `yaml:"-"`
-	Label           string                      `yaml:"label"`
-	FanSetUp        Duration                    `yaml:"fan_step_up"`
-	FanSetDown      Duration                    `yaml:"fan_step_down"`
-	CurvePointsYAML []map[string]map[string]int `yaml:"curve_points"`
-	CurvePoints     []map[int]map[string]int    `yaml:"-"`
+	Controller       string                           `yaml:"-"`
+	ID               openfan.Fan                      `yaml:"-"`
+	Label            string                           `yaml:"label"`
+	Mode             string                           `yaml:"mode"`
+	Control          string                           `yaml:"controller"` // curve (default) or pid
+	PID              *FanPID                          `yaml:"pid"`
+	FanSetUp         Duration                         `yaml:"fan_step_up"`
+	FanSetDown       Duration                         `yaml:"fan_step_down"`
+	RampUp           string                           `yaml:"ramp_up"`           // Maximum PWM increase in %/s
+	RampDown         string                           `yaml:"ramp_down"`         // Maximum PWM decrease in %/s
+	Hysteresis       float64                          `yaml:"hysteresis"`        // Temperature drop in °C before lowering the speed
+	SensorHysteresis map[string]float64               `yaml:"sensor_hysteresis"` // Overrides the hysteresis per temperature sensor
+	Hardware         *FanHardware                     `yaml:"hardware"`
+	Tach             *FanTach                         `yaml:"tach"`
+	Alarms           *FanAlarms                       `yaml:"alarms"`
+	SpinUp           *FanSpinUp                       `yaml:"spin_up"`
+	ZeroRPM          *FanZeroRPM                      `yaml:"zero_rpm"`
+	CurvePointsYAML  []map[string]map[string]float64  `yaml:"curve_points"`
+	CurvePoints      []map[float64]map[string]float64 `yaml:"-"`
+
+	rampUp   float64
+	rampDown float64
+}
+
+// FanTach describes the tachometer of the fan.
+type FanTach struct {
+	Model               string `yaml:"model"`
+	PulsesPerRevolution *int   `yaml:"pulses_per_revolution"`
+	MaxRPM              uint16 `yaml:"max_rpm"`
+}
+
+// Controllers compute the RPM of a fan assuming the standard 2 pulses per revolution.
+const defaultPulsesPerRevolution = 2
+
+// RPM corrects the RPM reported by the controller with the pulses per revolution of the fan.
+func (t *FanTach) RPM(reported uint16) uint16 {
+	if t == nil || t.PulsesPerRevolution == nil {
+		return reported
+	}
+
+	return uint16(min(uint32(reported)*defaultPulsesPerRevolution/uint32(*t.PulsesPerRevolution), math.MaxUint16))
+}
+
+// Reported converts the RPM of the fan to the RPM seen by the controller.
+func (t *FanTach) Reported(rpm uint16) uint16 {
+	if t == nil || t.PulsesPerRevolution == nil {
+		return rpm
+	}
+
+	return uint16(min(uint32(rpm)*uint32(*t.PulsesPerRevolution)/defaultPulsesPerRevolution, math.MaxUint16))
+}
+
+// FanSpinUp kick-starts the fan with a boost when it leaves a standstill for a low PWM.
+type FanSpinUp struct {
+	Boost    string   `yaml:"boost"`    // PWM commanded to start the fan
+	Duration Duration `yaml:"duration"` // Minimum duration of the boost, extended until the fan spins
+	Below    string   `yaml:"below"`    // The fan is also kicked when leaving a PWM below this one, defaults to its calibrated start duty
+
+	boost float64
+	below float64
+}
+
+// FanPID drives the fan with a PID controller keeping a temperature at its setpoint.
+type FanPID struct {
+	Sensor           string   `yaml:"sensor"`   // Name of the regulated temperature
+	Setpoint         float64  `yaml:"setpoint"` // Target temperature in °C
+	Kp               float64  `yaml:"kp"`       // PWM percent per °C above the setpoint
+	Ki               float64  `yaml:"ki"`       // PWM percent per °C.s above the setpoint
+	Kd               float64  `yaml:"kd"`       // PWM percent per °C/s of temperature increase
+	Min              string   `yaml:"min"`      // Output limits, the integral is bounded by them
+	Max              string   `yaml:"max"`
+	DerivativeFilter Duration `yaml:"derivative_filter"` // Time constant of the low-pass filter of the derivative
+
+	min float64
+	max float64
+}
+
+// FanZeroRPM stops the fan while all its temperatures are low.
+type FanZeroRPM struct {
+	StopBelow  float64  `yaml:"stop_below"`  // The fan stops once all its temperatures are below this one
+	StartAbove float64  `yaml:"start_above"` // The fan starts again once one of its temperatures is above this one
+	MinOff     Duration `yaml:"min_off"`     // Minimum duration of a stop
+	MinOn      Duration `yaml:"min_on"`      // Minimum duration of a run before stopping again
+}
+
+// FanAlarms enables the stall, overspeed and erratic tachometer detection of the fan.
+type FanAlarms struct {
+	Delay         Duration `yaml:"delay"`          // Duration of a condition before raising an alarm, and of its absence before clearing it
+	StallPWM      string   `yaml:"stall_pwm"`      // The fan is expected to spin when commanded at least this PWM
+	StallRPM      uint16   `yaml:"stall_rpm"`      // The fan is stalled when spinning at most this RPM
+	OverspeedRPM  uint16   `yaml:"overspeed_rpm"`  // Defaults to 120% of the tach max_rpm
+	ErraticChange string   `yaml:"erratic_change"` // RPM change between two readings at a steady command
+	ErraticCount  int      `yaml:"erratic_count"`  // Number of erratic readings before raising the alarm
+	Boost         string   `yaml:"boost"`          // PWM applied on boost_fans while an alarm is raised
+	BoostFans     []string `yaml:"boost_fans"`     // Defaults to the other PWM fans of the controller
+
+	stallPWM      float64
+	erraticChange float64
+	boost         float64
+	boostFans     []Channel
+}
+
+// FanHardware overrides the settings of the fan driver, unset values are left untouched.
+type FanHardware struct {
+	PWMFrequency string   `yaml:"pwm_frequency"`
+	SpinUpLevel  string   `yaml:"spin_up_level"`
+	SpinUpTime   Duration `yaml:"spin_up_time"`
+	SpinUpKick   *bool    `yaml:"spin_up_kick"`
+	RPMRange     int      `yaml:"rpm_range"`
+	Edges        int      `yaml:"edges"`
+	MinDrive     string   `yaml:"min_drive"`
+}
+
+// Apply returns d with the configured values.
+func (h FanHardware) Apply(d openfan.FanDriver) (openfan.FanDriver, error) {
+	var err error
+
+	if h.PWMFrequency != "" {
+		d.PWMFrequency, err = openfan.ParsePWMFrequency(h.PWMFrequency)
+		if err != nil {
+			return d, err
+		}
+	}
+	if h.SpinUpLevel != "" {
+		v, err := parsePercent(h.SpinUpLevel)
+		if err != nil {
+			return d, fmt.Errorf("spin_up_level: %w", err)
+		}
+		if v != math.Trunc(v) {
+			return d, fmt.Errorf("spin_up_level: %s: must be a whole percent", h.SpinUpLevel)
+		}
+		d.SpinUpLevel = int(v)
+	}
+	if h.SpinUpTime.Duration > 0 {
+		d.SpinUpTime = h.SpinUpTime.Duration
+	}
+	if h.SpinUpKick != nil {
+		d.SpinUpKick = *h.SpinUpKick
+	}
+	if h.RPMRange > 0 {
+		d.RPMRange = h.RPMRange
+	}
+	if h.Edges > 0 {
+		d.Edges = h.Edges
+	}
+	if h.MinDrive != "" {
+		v, err := parsePercent(h.MinDrive)
+		if err != nil {
+			return d, fmt.Errorf("min_drive: %w", err)
+		}
+		d.MinDrive = uint8(math.Round(v * 255 / 100))
+	}
+
+	return d, d.Validate()
+}
+
+func (s *FanSpinUp) parse() error {
+	if s.Boost == "" {
+		return errors.New("no boost provided")
+	}
+
+	v, err := parsePercent(s.Boost)
+	if err != nil {
+		return fmt.Errorf("boost: %w", err)
+	}
+	s.boost = v
+
+	if s.Duration.Duration <= 0 {
+		s.Duration.Duration = 2 * time.Second
+	}
+
+	if s.Below != "" {
+		v, err = parsePercent(s.Below)
+		if err != nil {
+			return fmt.Errorf("below: %w", err)
+		}
+		s.below = v
+	}
+
+	return nil
+}
+
+func (p *FanPID) parse() error {
+	if p.Sensor == "" {
+		return errors.New("no sensor provided")
+	}
+	if p.Kp < 0 || p.Ki < 0 || p.Kd < 0 {
+		return errors.New("kp, ki and kd must be positive")
+	}
+	if p.DerivativeFilter.Duration < 0 {
+		return fmt.Errorf("invalid derivative_filter %s", p.DerivativeFilter.Duration)
+	}
+
+	p.max = 100
+	if p.Max != "" {
+		v, err := parsePercent(p.Max)
+		if err != nil {
+			return fmt.Errorf("max: %w", err)
+		}
+		p.max = v
+	}
+	if p.Min != "" {
+		v, err := parsePercent(p.Min)
+		if err != nil {
+			return fmt.Errorf("min: %w", err)
+		}
+		p.min = v
+	}
+	if p.min >= p.max {
+		return fmt.Errorf("min %s must be lower than max %s", p.Min, p.Max)
+	}
+
+	return nil
+}
+
+func (z *FanZeroRPM) validate() error {
+	if z.StartAbove <= z.StopBelow {
+		return fmt.Errorf("start_above %g must be greater than stop_below %g", z.StartAbove, z.StopBelow)
+	}
+	if z.MinOff.Duration < 0 {
+		return fmt.Errorf("invalid min_off %s", z.MinOff.Duration)
+	}
+	if z.MinOn.Duration < 0 {
+		return fmt.Errorf("invalid min_on %s", z.MinOn.Duration)
+	}
+
+	return nil
+}
+
+func (a *FanAlarms) parse(tach *FanTach) error {
+	if a.Delay.Duration == 0 {
+		a.Delay.Duration = 10 * time.Second
+	}
+
+	a.stallPWM = 20
+	if a.StallPWM != "" {
+		v, err := parsePercent(a.StallPWM)
+		if err != nil {
+			return fmt.Errorf("stall_pwm: %w", err)
+		}
+		a.stallPWM = v
+	}
+
+	if a.OverspeedRPM == 0 && tach != nil {
+		a.OverspeedRPM = uint16(min(uint32(tach.MaxRPM)*120/100, math.MaxUint16))
+	}
+
+	if a.ErraticChange != "" {
+		v, err := parsePercent(a.ErraticChange)
+		if err != nil {
+			return fmt.Errorf("erratic_change: %w", err)
+		}
+		a.erraticChange = v
+	}
+	if a.ErraticCount <= 0 {
+		a.ErraticCount = 3
+	}
+
+	if a.Boost != "" {
+		v, err := parsePercent(a.Boost)
+		if err != nil {
+			return fmt.Errorf("boost: %w", err)
+		}
+		a.boost = v
+	}
+
+	return nil
+}
+
+func (a *FanAlarms) resolveBoostFans(self Channel, fans map[string]*Fan) error {
+	if len(a.BoostFans) == 0 {
+		for _, fan := range fans {
+			if fan.Controller == self.Controller && fan.Channel() != self && fan.Mode == ModePWM {
+				a.boostFans = append(a.boostFans, fan.Channel())
+			}
+		}
+		return nil
+	}
+
+	for _, name := range a.BoostFans {
+		ch, err := ParseChannel(name)
+		if err != nil {
+			return fmt.Errorf("boost_fans: %s: %w", name, err)
+		}
+
+		var found bool
+		for _, fan := range fans {
+			if fan.Channel() == ch && fan.Mode == ModePWM {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("boost_fans: %s: not a PWM fan of fan_settings", name)
+		}
+
+		a.boostFans = append(a.boostFans, ch)
+	}
+
+	return nil
+}
+
+var reRate = regexp.MustCompile(`^(\d+(?:\.\d+)?)%/s$`)
+
+// parseRate parses a rate in percent per second such as `5%/s`.
+func parseRate(s string) (float64, error) {
+	match := reRate.FindStringSubmatch(s)
+	if len(match) != 2 {
+		return 0, fmt.Errorf("invalid rate format %s", s)
+	}
+
+	v, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s, err)
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("%s: must be greater than 0", s)
+	}
+
+	return v, nil
+}
+
+func parsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("invalid percent format %s", s)
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s, err)
+	}
+	if math.IsNaN(v) || v < 0 || v > 100 {
+		return 0, fmt.Errorf("%s: must in range [0,100]", s)
+	}
+
+	return v, nil
+}
+
+var reFanName = regexp.MustCompile(`^(?:([\w.-]+)/)?fan(\d+)$`)
+
+// ParseChannel parses a fan name such as `fan1` or `bottom/fan3`.
+func ParseChannel(name string) (Channel, error) {
+	match := reFanName.FindStringSubmatch(name)
+	if len(match) != 3 {
+		return Channel{}, errors.New("invalid name")
+	}
+
+	ch := Channel{Controller: match[1]}
+	if ch.Controller == "" {
+		ch.Controller = DefaultController
+	}
+
+	id, err := strconv.ParseUint(match[2], 10, 8)
+	if err != nil {
+		return ch, errors.New("invalid number") // Should not happen because of the regex check
+	}
+	if id < 1 {
+		return ch, errors.New("invalid number range") // The upper bound is checked against the hardware
+	}
+
+	ch.Fan = openfan.Fan(id - 1) // fan1 => 0, fan10 => 9
+	return ch, nil
+}
+
+func (f Fan) Channel() Channel {
+	return Channel{Controller: f.Controller, Fan: f.ID}
 }
 
 func Load(path string) (Config, error) {
@@ -43,47 +511,226 @@ func Load(path string) (Config, error) {
 
 	//
 
-	reName := regexp.MustCompile(`^fan(\d+)$`)
-	rePWM := regexp.MustCompile(`\d+%`)
-	for fname, fan := range c.FanSettings {
-		match := reName.FindStringSubmatch(fname)
-		if len(match) != 2 {
-			return c, fmt.Errorf("%s: invalid name", fname)
+	if c.StateFile == "" {
+		c.StateFile = DefaultStateFile
+	}
+
+	if err = c.Device.validate(); err != nil {
+		return c, fmt.Errorf("device: %w", err)
+	}
+	if len(c.Controllers) > 0 && (c.Device.SerialNumber != "" || c.Device.Port != "") {
+		// Only the serial port settings are inherited by the controllers.
+		return c, fmt.Errorf("device: serial_number and port must be set in each of the controllers")
+	}
+
+	reController := regexp.MustCompile(`^[\w.-]+$`)
+	for name, controller := range c.Controllers {
+		if !reController.MatchString(name) {
+			return c, fmt.Errorf("controllers: %s: invalid name", name)
+		}
+		if controller == nil {
+			controller = &ControllerSettings{}
+			c.Controllers[name] = controller
+		}
+
+		controller.Name = name
+
+		switch controller.Type {
+		case "", ControllerOpenFan:
+			controller.Type = ControllerOpenFan
+			if err = controller.Device.validate(); err != nil {
+				return c, fmt.Errorf("controllers: %s: %w", name, err)
+			}
+			controller.Device = controller.Device.inherit(c.Device)
+		case ControllerHWMon:
+			if controller.HWMon == "" {
+				return c, fmt.Errorf("controllers: %s: no hwmon chip provided", name)
+			}
+		case ControllerHTTP:
+			if controller.HTTP == nil || controller.HTTP.URL == "" {
+				return c, fmt.Errorf("controllers: %s: no http url provided", name)
+			}
+			if controller.HTTP.Channels < 0 {
+				return c, fmt.Errorf("controllers: %s: invalid number of channels %d", name, controller.HTTP.Channels)
+			}
+		default:
+			return c, fmt.Errorf("controllers: %s: invalid type %s", name, controller.Type)
 		}
-		id, err := strconv.ParseUint(match[1], 10, 8)
+	}
+
+	rePWM := regexp.MustCompile(`^\d+(?:\.\d+)?%$`)
+	reRPM := regexp.MustCompile(`^\d+rpm$`)
+	for fname, fan := range c.FanSettings {
+		ch, err := ParseChannel(fname)
 		if err != nil {
-			return c, fmt.Errorf("%s: invalid number", fname) // Should not happen because of the regex check
+			return c, fmt.Errorf("%s: %w", fname, err)
+		}
+		if _, ok := c.Controllers[ch.Controller]; !ok && len(c.Controllers) > 0 {
+			return c, fmt.Errorf("%s: unknown controller %s", fname, ch.Controller)
+		}
+
+		fan.Controller = ch.Controller
+		fan.ID = ch.Fan
+
+		switch fan.Mode {
+		case "":
+			fan.Mode = ModePWM
+		case ModePWM, ModeRPM:
+		default:
+			return c, fmt.Errorf("%s: invalid mode %s", fname, fan.Mode)
+		}
+
+		if fan.Control == "" {
+			fan.Control = ControlCurve
+		}
+		switch fan.Control {
+		case ControlCurve:
+			if fan.PID != nil {
+				return c, fmt.Errorf("%s: pid: only supported by the %s controller", fname, ControlPID)
+			}
+		case ControlPID:
+			if fan.Mode != ModePWM {
+				return c, fmt.Errorf("%s: controller %s only supported in %s mode", fname, ControlPID, ModePWM)
+			}
+			if fan.PID == nil {
+				return c, fmt.Errorf("%s: no pid provided", fname)
+			}
+			if err = fan.PID.parse(); err != nil {
+				return c, fmt.Errorf("%s: pid: %w", fname, err)
+			}
+		default:
+			return c, fmt.Errorf("%s: invalid controller %s", fname, fan.Control)
+		}
+
+		if controller, ok := c.Controllers[fan.Controller]; ok && controller.Type != ControllerOpenFan {
+			if fan.Mode == ModeRPM && controller.Type == ControllerHWMon {
+				return c, fmt.Errorf("%s: mode %s not supported by %s", fname, fan.Mode, controller.Type)
+			}
+			if fan.Hardware != nil {
+				return c, fmt.Errorf("%s: hardware not supported by %s", fname, controller.Type)
+			}
+		}
+
+		if fan.Hardware != nil {
+			// Check the settings against the datasheet defaults.
+			_, err = fan.Hardware.Apply(openfan.FanDriver{
+				SpinUpLevel: 60,
+				SpinUpTime:  500 * time.Millisecond,
+				SpinUpKick:  true,
+				RPMRange:    1000,
+				Edges:       5,
+			})
+			if err != nil {
+				return c, fmt.Errorf("%s: hardware: %w", fname, err)
+			}
+		}
+
+		if fan.Tach != nil && fan.Tach.PulsesPerRevolution != nil {
+			if ppr := *fan.Tach.PulsesPerRevolution; ppr < 1 || ppr > 8 {
+				return c, fmt.Errorf("%s: tach: pulses_per_revolution must be in range [1,8]", fname)
+			}
+			if fan.Hardware != nil && fan.Hardware.Edges > 0 {
+				// The EMC2305 already measures the RPM with the given edges.
+				return c, fmt.Errorf("%s: tach: pulses_per_revolution and hardware edges are mutually exclusive", fname)
+			}
+		}
+
+		if fan.RampUp != "" || fan.RampDown != "" {
+			if fan.Mode != ModePWM {
+				return c, fmt.Errorf("%s: ramp_up and ramp_down are only supported in %s mode", fname, ModePWM)
+			}
+		}
+		if fan.RampUp != "" {
+			if fan.rampUp, err = parseRate(fan.RampUp); err != nil {
+				return c, fmt.Errorf("%s: ramp_up: %w", fname, err)
+			}
 		}
-		if id < 1 || id > 10 {
-			return c, fmt.Errorf("%s: invalid number range", fname)
+		if fan.RampDown != "" {
+			if fan.rampDown, err = parseRate(fan.RampDown); err != nil {
+				return c, fmt.Errorf("%s: ramp_down: %w", fname, err)
+			}
 		}
 
-		fan.ID = openfan.Fan(id - 1) // fan1 => 0, fan10 => 9
+		if fan.SpinUp != nil {
+			if fan.Mode != ModePWM {
+				return c, fmt.Errorf("%s: spin_up: only supported in %s mode", fname, ModePWM)
+			}
+			if err = fan.SpinUp.parse(); err != nil {
+				return c, fmt.Errorf("%s: spin_up: %w", fname, err)
+			}
+		}
 
-		if len(fan.CurvePointsYAML) == 0 {
+		if fan.ZeroRPM != nil {
+			if err = fan.ZeroRPM.validate(); err != nil {
+				return c, fmt.Errorf("%s: zero_rpm: %w", fname, err)
+			}
+		}
+
+		if fan.Alarms != nil {
+			if err = fan.Alarms.parse(fan.Tach); err != nil {
+				return c, fmt.Errorf("%s: alarms: %w", fname, err)
+			}
+		}
+
+		if len(fan.CurvePointsYAML) == 0 && fan.Control != ControlPID {
 			return c, fmt.Errorf("%s: no curve_points provided", fname)
 		}
 
-		fan.CurvePoints = make([]map[int]map[string]int, len(fan.CurvePointsYAML))
+		if fan.Hysteresis < 0 {
+			return c, fmt.Errorf("%s: invalid hysteresis %g", fname, fan.Hysteresis)
+		}
+		for name, h := range fan.SensorHysteresis {
+			if h < 0 {
+				return c, fmt.Errorf("%s: sensor_hysteresis: %s: invalid hysteresis %g", fname, strconv.Quote(name), h)
+			}
+
+			used := slices.ContainsFunc(fan.CurvePointsYAML, func(point map[string]map[string]float64) bool {
+				for _, thresholds := range point {
+					if _, ok := thresholds[name]; ok {
+						return true
+					}
+				}
+				return false
+			})
+			if !used {
+				return c, fmt.Errorf("%s: sensor_hysteresis: %s: not a temperature of curve_points", fname, strconv.Quote(name))
+			}
+		}
+
+		fan.CurvePoints = make([]map[float64]map[string]float64, len(fan.CurvePointsYAML))
 
-		var prevPWM int
+		var prevPWM float64
 		for i, point := range fan.CurvePointsYAML {
-			fan.CurvePoints[i] = make(map[int]map[string]int)
+			fan.CurvePoints[i] = make(map[float64]map[string]float64)
 
 			for pwm, thresholds := range point {
-				if !rePWM.MatchString(pwm) {
-					return c, fmt.Errorf("%s: invalid pwm format %s", fname, pwm)
-				}
+				var PWM float64
+				switch fan.Mode {
+				case ModeRPM:
+					if !reRPM.MatchString(pwm) {
+						return c, fmt.Errorf("%s: invalid rpm format %s", fname, pwm)
+					}
 
-				PWM, err := strconv.Atoi(strings.TrimRight(pwm, "%"))
-				if err != nil {
-					return c, fmt.Errorf("%s: %s: %w", fname, pwm, err)
-				}
-				if PWM < 0 || PWM > 100 {
-					return c, fmt.Errorf("%s: %s: pwm must in range [0,100]", fname, pwm)
+					RPM, err := strconv.ParseUint(strings.TrimSuffix(pwm, "rpm"), 10, 16)
+					if err != nil {
+						return c, fmt.Errorf("%s: %s: %w", fname, pwm, err)
+					}
+					PWM = float64(RPM) // Curve values are RPMs
+				default:
+					if !rePWM.MatchString(pwm) {
+						return c, fmt.Errorf("%s: invalid pwm format %s", fname, pwm)
+					}
+
+					PWM, err = strconv.ParseFloat(strings.TrimRight(pwm, "%"), 64)
+					if err != nil {
+						return c, fmt.Errorf("%s: %s: %w", fname, pwm, err)
+					}
+					if PWM < 0 || PWM > 100 {
+						return c, fmt.Errorf("%s: %s: pwm must in range [0,100]", fname, pwm)
+					}
 				}
 				if PWM < prevPWM {
-					return c, fmt.Errorf("%s: %s: pwm greater than previous one", fname, pwm)
+					return c, fmt.Errorf("%s: %s: %s greater than previous one", fname, pwm, fan.Mode)
 				}
 				prevPWM = PWM
 
@@ -96,5 +743,16 @@ func Load(path string) (Config, error) {
 		}
 	}
 
+	// Resolve the boosted fans once all the fans are known.
+	for fname, fan := range c.FanSettings {
+		if fan.Alarms == nil || fan.Alarms.boost == 0 {
+			continue
+		}
+
+		if err = fan.Alarms.resolveBoostFans(fan.Channel(), c.FanSettings); err != nil {
+			return c, fmt.Errorf("%s: alarms: %w", fname, err)
+		}
+	}
+
 	return c, nil
 }
@@ -0,0 +1,28 @@
+package openfand
+
+import "testing"
+
+func TestParsePercent(t *testing.T) {
+	for s, tc := range map[string]struct {
+		want  float64
+		valid bool
+	}{
+		"0%":     {want: 0, valid: true},
+		"40%":    {want: 40, valid: true},
+		"12.5%":  {want: 12.5, valid: true},
+		"100%":   {want: 100, valid: true},
+		"40":     {},
+		"-1%":    {},
+		"100.5%": {},
+		"NaN%":   {},
+		"abc%":   {},
+	} {
+		got, err := parsePercent(s)
+		if tc.valid && (err != nil || got != tc.want) {
+			t.Errorf("%s: got %g (%v), want %g", s, got, err, tc.want)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: got %g, want an error", s, got)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mdouchement/logger"
@@ -19,34 +20,122 @@ import (
 )
 
 type Controller struct {
-	fan      OpenFan
-	sensor   Sensor
-	shaper   Shaper
-	events   chan event
-	listener net.Listener
-	ticker   *time.Ticker
-	fans     map[openfan.Fan]Fan
-	active   map[openfan.Fan]Evaluation
-	pending  map[openfan.Fan]Evaluation
+	controllers map[string]OpenFan
+	channels    map[string]int
+	sensor      Sensor
+	shaper      Shaper
+	events      chan event
+	statuses    chan ControllerStatus
+	listener    net.Listener
+	ticker      *time.Ticker
+	polling     time.Duration
+	now         func() time.Time // Clock of the spin-ups, ramps, retries and alarms
+	fans        map[Channel]Fan
+	active      map[Channel]Evaluation
+	applied     map[Channel]Evaluation // Confirmed writes, owned by the eval goroutine
+	pending     map[Channel]Evaluation
+	alarms      map[Channel]*fanAlarms
+	sync        sync.Mutex
+	boosts      map[Channel]float64 // PWM applied on fans boosted by a raised alarm
+	rpms        map[Channel]uint16  // Last read RPMs, shared with the eval goroutine
+	stateFile   string
+	stateSync   sync.Mutex // Serializes the writes of the state file
+	// registerWrites allows raw register writes through the socket.
+	registerWrites bool
+	// Fans driven by a calibration, false once released until their next confirmed write.
+	calibrating  map[Channel]bool
+	calibrations map[Channel]Calibration
+	forced       map[Channel]bool // Fans written on next evaluation whatever their active value
+	kicks        map[Channel]kickStart
+	ramps        map[Channel]rampStep
+	retries      map[Channel]writeRetry // Failed writes, retried once their backoff elapsed
 }
 
-func New(cfg Config, fan OpenFan, sensor Sensor, shaper Shaper, polling time.Duration) (*Controller, error) {
+func New(cfg Config, controllers map[string]OpenFan, sensor Sensor, shaper Shaper, polling time.Duration) (*Controller, error) {
 	c := &Controller{
-		fan:     fan,
-		sensor:  sensor,
-		shaper:  shaper,
-		events:  make(chan event, 10),
-		ticker:  time.NewTicker(polling),
-		fans:    make(map[openfan.Fan]Fan),
-		active:  make(map[openfan.Fan]Evaluation),
-		pending: make(map[openfan.Fan]Evaluation),
+		controllers:    controllers,
+		channels:       make(map[string]int),
+		sensor:         sensor,
+		shaper:         shaper,
+		events:         make(chan event, 10),
+		statuses:       make(chan ControllerStatus, 16),
+		ticker:         time.NewTicker(polling),
+		polling:        polling,
+		now:            time.Now,
+		fans:           make(map[Channel]Fan),
+		active:         make(map[Channel]Evaluation),
+		applied:        make(map[Channel]Evaluation),
+		pending:        make(map[Channel]Evaluation),
+		alarms:         make(map[Channel]*fanAlarms),
+		rpms:           make(map[Channel]uint16),
+		stateFile:      cfg.StateFile,
+		registerWrites: cfg.RegisterWrites,
+		calibrating:    make(map[Channel]bool),
+		calibrations:   make(map[Channel]Calibration),
+		forced:         make(map[Channel]bool),
+		kicks:          make(map[Channel]kickStart),
+		ramps:          make(map[Channel]rampStep),
+		retries:        make(map[Channel]writeRetry),
 	}
 
-	for _, fan := range cfg.FanSettings {
-		c.fans[fan.ID] = *fan
+	for name, controller := range controllers {
+		n, err := controller.Channels()
+		if err != nil {
+			return nil, fmt.Errorf("%s: channels: %w", name, err)
+		}
+
+		c.channels[name] = n
+	}
+
+	for fname, fan := range cfg.FanSettings {
+		if _, ok := controllers[fan.Controller]; !ok {
+			// Discovered boards are named by their serial number when several are plugged.
+			return nil, fmt.Errorf("%s: controller %s not found, available controllers: %s", fname, fan.Controller, strings.Join(slices.Sorted(maps.Keys(controllers)), ", "))
+		}
+		if n := c.channels[fan.Controller]; int(fan.ID) >= n {
+			return nil, fmt.Errorf("%s: controller %s only has %d channels", fname, fan.Controller, n)
+		}
+
+		c.fans[fan.Channel()] = *fan
+		if fan.Alarms != nil {
+			c.alarms[fan.Channel()] = newFanAlarms()
+		}
+
+		if fan.Hardware != nil {
+			driver, ok := controllers[fan.Controller].(fanDriver)
+			if !ok {
+				return nil, fmt.Errorf("%s: hardware: not supported by controller %s", fname, fan.Controller)
+			}
+
+			d, err := driver.FanDriver(fan.ID)
+			if err != nil {
+				return nil, fmt.Errorf("%s: hardware: %w", fname, err)
+			}
+
+			d, err = fan.Hardware.Apply(d)
+			if err != nil {
+				return nil, fmt.Errorf("%s: hardware: %w", fname, err)
+			}
+
+			if err = driver.SetFanDriver(fan.ID, d); err != nil {
+				return nil, fmt.Errorf("%s: hardware: %w", fname, err)
+			}
+		}
 	}
 
-	err := os.MkdirAll(filepath.Dir(cfg.Socket), 0o755)
+	calibrations, err := LoadCalibrations(c.stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+	for name, cal := range calibrations {
+		ch, err := ParseChannel(name)
+		if err != nil {
+			return nil, fmt.Errorf("state: %s: %w", name, err)
+		}
+		c.calibrations[ch] = cal
+	}
+
+	err = os.MkdirAll(filepath.Dir(cfg.Socket), 0o755)
 	if err != nil {
 		return nil, fmt.Errorf("socket: %w", err)
 	}
@@ -68,7 +157,31 @@ func (c *Controller) Launch(ctx context.Context) {
 
 	go c.eventLoop(ctx)
 
+	for name, controller := range c.controllers {
+		status := ControllerStatus{Name: name, Channels: c.channels[name], Connected: true}
+		if p, ok := controller.(interface{ Port() string }); ok {
+			status.Port = p.Port()
+		}
+		if notifier, ok := controller.(statusNotifier); ok {
+			status = toControllerStatus(name, c.channels[name], notifier.Status())
+			notifier.SetStatusHandler(func(s openfan.Status) {
+				select {
+				case c.statuses <- toControllerStatus(name, c.channels[name], s):
+				default:
+					log.Warnf("Dropping status of %s", name) // Should never happen
+				}
+			})
+		}
+
+		c.events <- event{name: eventUpdateStatus, status: status}
+	}
+
 	http.HandleFunc("/monitor", c.monitor(log))
+	http.HandleFunc("GET /hardware", c.hardwareInfo(log))
+	http.HandleFunc("GET /hardware/registers", c.registers(log))
+	http.HandleFunc("GET /hardware/register", c.register(log))
+	http.HandleFunc("PUT /hardware/register", c.register(log))
+	http.HandleFunc("POST /calibrate", c.calibrate(log))
 	go func() {
 		for {
 			log.Info("Staring HTTP server on", c.listener.Addr().String())
@@ -80,7 +193,7 @@ func (c *Controller) Launch(ctx context.Context) {
 		}
 	}()
 
-	evalCh := make(chan map[openfan.Fan]Evaluation, 1)
+	evalCh := make(chan map[Channel]Evaluation, 1)
 	refreshCh := make(chan refresh, 1)
 	go c.gatherTemperatures(log, evalCh)
 	go c.eval(log, evalCh, refreshCh)
@@ -88,25 +201,62 @@ func (c *Controller) Launch(ctx context.Context) {
 	refreshCh <- refresh{interval: 10 * time.Second} // At least RPMs are refreshed every this interval
 
 	go func() {
+		var bursting bool // A burst of refreshes is running after a write phase
+		var extended bool // Another write phase happened during the burst
 		for {
 			select {
 			case e := <-refreshCh:
-				rpms, err := c.fan.RPMs()
-				if err != nil {
-					log.WithError(err).Error("Could not read RPMs")
-					continue
+				if e.until > 0 && e.current == 0 {
+					if bursting {
+						extended = true
+						continue
+					}
+					bursting = true
+				}
+
+				rpms := map[Channel]uint16{}
+				for name, controller := range c.controllers {
+					values, err := controller.RPMs()
+					if err != nil {
+						log.WithError(err).Errorf("Could not read RPMs of %s", name)
+						continue
+					}
+
+					for fid, rpm := range values {
+						ch := Channel{Controller: name, Fan: fid}
+						rpms[ch] = c.fans[ch].Tach.RPM(rpm)
+					}
 				}
 
 				c.events <- event{name: eventUpdateRPMs, rpms: rpms}
 
 				// Prepare next iteration.
-				if e.until == 0 || e.current < e.until {
-					e.current++
-					time.AfterFunc(e.interval, func() {
-						refreshCh <- e
-					})
+				if e.until > 0 && e.current >= e.until {
+					if !extended {
+						bursting = false
+						continue
+					}
+
+					// Restart the burst instead of stacking several of them.
+					extended = false
+					e.current = 0
+				}
+
+				e.current++
+				time.AfterFunc(e.interval, func() {
+					refreshCh <- e
+				})
+
+			case s := <-c.statuses:
+				switch {
+				case s.Connected:
+					log.Infof("Controller %s connected on %s (%d reconnections)", s.Name, s.Port, s.Reconnects)
+				case s.Error != "":
+					log.Warnf("Controller %s disconnected: %s", s.Name, s.Error)
 				}
 
+				c.events <- event{name: eventUpdateStatus, status: s}
+
 			case <-ctx.Done():
 				c.ticker.Stop()
 				close(evalCh)
@@ -129,16 +279,51 @@ func (c *Controller) Launch(ctx context.Context) {
 func (c *Controller) eventLoop(ctx context.Context) {
 	log := logger.LogWith(ctx)
 	watchers := map[int64]chan<- []byte{}
+	statuses := map[string]ControllerStatus{}
 
 	for e := range c.events {
+		var dirty bool // The watchers are refreshed once the event is handled, self-sent events could fill the channel
+
 		switch e.name {
 		case eventUpdateEval:
-			c.active[e.eval.ID] = e.eval
+			e.eval.RPM = c.active[e.eval.Channel()].RPM
+			e.eval.WriteFailures = c.active[e.eval.Channel()].WriteFailures
+			c.active[e.eval.Channel()] = e.eval
+		case eventWriteFailure:
+			eval := c.activeEval(e.channel)
+			eval.WriteFailures++
+			c.active[e.channel] = eval
+		case eventUpdateStatus:
+			e.status.WriteLatency = statuses[e.status.Name].WriteLatency
+			statuses[e.status.Name] = e.status
+			dirty = true
+		case eventUpdateLatency:
+			status := statuses[e.status.Name]
+			status.WriteLatency = e.status.WriteLatency
+			statuses[e.status.Name] = status
 		case eventUpdateRPMs:
 			var change bool
+			var alarmed bool
+
+			c.sync.Lock()
+			maps.Copy(c.rpms, e.rpms)
+			calibrating := maps.Clone(c.calibrating)
+			c.sync.Unlock()
 
 			for fid, rpm := range e.rpms {
-				eval := c.active[fid]
+				eval := c.activeEval(fid)
+
+				_, swept := calibrating[fid] // The calibration would raise the alarms on purpose
+				if alarms, ok := c.alarms[fid]; ok && !swept {
+					for name, reason := range alarms.check(c.now(), c.fans[fid].Alarms, eval, rpm) {
+						alarmed = true
+						if alarms.alarms[name].state == alarmRaised {
+							log.Warnf("Alarm %s raised for %s(%s): %s", name, fid, c.fans[fid].Label, reason)
+							continue
+						}
+						log.Infof("Alarm %s cleared for %s(%s): %s", name, fid, c.fans[fid].Label, reason)
+					}
+				}
 
 				const tolerance = 5
 				if eval.RPM != 0 && (rpm < eval.RPM-tolerance || rpm > eval.RPM+tolerance) {
@@ -150,41 +335,108 @@ func (c *Controller) eventLoop(ctx context.Context) {
 				c.active[fid] = eval
 			}
 
+			if alarmed {
+				c.updateBoosts()
+			}
+
 			if change {
 				var speeds []string
-				for _, fid := range slices.Sorted(maps.Keys(e.rpms)) {
+				for _, fid := range slices.SortedFunc(maps.Keys(e.rpms), Channel.Compare) {
 					rpm := e.rpms[fid]
 					if rpm == 0 {
 						continue
 					}
-					speeds = append(speeds, fmt.Sprintf("fan%d(%s): %d", fid+1, c.fans[fid].Label, rpm))
+					speeds = append(speeds, fmt.Sprintf("%s(%s): %d", fid, c.fans[fid].Label, rpm))
 				}
 				log.Info(strings.Join(speeds, " - "))
 			}
 
-			c.events <- event{name: eventRefreshWatchers}
-
-		case eventRefreshWatchers:
-			payload, err := json.Marshal(slices.Collect(maps.Values(c.active)))
-			if err != nil {
-				log.WithError(err).Error("Could not serialize metrics") // Should never happen
-				continue
-			}
-
-			for _, watcher := range watchers {
-				watcher <- payload
-			}
+			dirty = true
 		case eventWatch:
 			watchers[e.monitorID] = e.monitor
-			c.events <- event{name: eventRefreshWatchers}
+			dirty = true
 		case eventUnwatch:
 			close(watchers[e.monitorID])
 			delete(watchers, e.monitorID)
 		}
+
+		if !dirty {
+			continue
+		}
+
+		payload, err := json.Marshal(Snapshot{
+			Controllers: slices.SortedFunc(maps.Values(statuses), func(a, b ControllerStatus) int {
+				return strings.Compare(a.Name, b.Name)
+			}),
+			Evaluations: c.evaluations(),
+		})
+		if err != nil {
+			log.WithError(err).Error("Could not serialize metrics") // Should never happen
+			continue
+		}
+
+		for _, watcher := range watchers {
+			watcher <- payload
+		}
 	}
 }
 
-func (c *Controller) gatherTemperatures(log logger.Logger, ch chan<- map[openfan.Fan]Evaluation) {
+// evaluations returns the active evaluations along with the tachometer profile of the fans.
+func (c *Controller) evaluations() []Evaluation {
+	c.sync.Lock()
+	calibrations := c.calibrations
+	c.sync.Unlock()
+
+	evals := make([]Evaluation, 0, len(c.active))
+	for fid, eval := range c.active {
+		if alarms, ok := c.alarms[fid]; ok {
+			eval.Alarms = alarms.raised()
+		}
+		if tach := c.fans[fid].Tach; tach != nil {
+			eval.Model = tach.Model
+			eval.MaxRPM = tach.MaxRPM
+		}
+		if cal, ok := calibrations[fid]; ok && eval.MaxRPM == 0 {
+			eval.MaxRPM = cal.MaxRPM
+		}
+		evals = append(evals, eval)
+	}
+
+	return evals
+}
+
+// updateBoosts computes the PWM of the fans boosted by the raised alarms.
+func (c *Controller) updateBoosts() {
+	boosts := map[Channel]float64{}
+	for fid, alarms := range c.alarms {
+		settings := c.fans[fid].Alarms
+		if settings.boost == 0 || len(alarms.raised()) == 0 {
+			continue
+		}
+
+		for _, ch := range settings.boostFans {
+			boosts[ch] = max(boosts[ch], settings.boost)
+		}
+	}
+
+	c.sync.Lock()
+	c.boosts = boosts
+	c.sync.Unlock()
+}
+
+// activeEval returns the active evaluation of the channel, initialized from the fan settings when none has been applied yet.
+func (c *Controller) activeEval(fid Channel) Evaluation {
+	eval, ok := c.active[fid]
+	if !ok {
+		eval.Controller = fid.Controller
+		eval.ID = fid.Fan
+		eval.Label = c.fans[fid].Label
+		eval.Mode = c.fans[fid].Mode
+	}
+	return eval
+}
+
+func (c *Controller) gatherTemperatures(log logger.Logger, ch chan<- map[Channel]Evaluation) {
 	for range c.ticker.C {
 		temps, err := c.sensor.Temperatures()
 		if err != nil {
@@ -196,64 +448,268 @@ func (c *Controller) gatherTemperatures(log logger.Logger, ch chan<- map[openfan
 	}
 }
 
-func (c *Controller) eval(log logger.Logger, ch <-chan map[openfan.Fan]Evaluation, refreshCh chan<- refresh) {
+func (c *Controller) eval(log logger.Logger, ch <-chan map[Channel]Evaluation, refreshCh chan<- refresh) {
 	for evals := range ch {
-		var toRefresh bool
+		batches := map[string][]Evaluation{}
+		kicking := map[Channel]bool{}
+
+		c.sync.Lock()
+		boosts := c.boosts
+		calibrations := c.calibrations
+		calibrating := maps.Clone(c.calibrating)
+		rpms := maps.Clone(c.rpms)
+		for fid, running := range c.calibrating {
+			if !running {
+				// Released by the calibration, its PWM must be restored.
+				c.forced[fid] = true
+				delete(c.calibrating, fid)
+			}
+		}
+		c.sync.Unlock()
 
 		for fid, eval := range evals {
-			sa, ok := c.active[fid]
-			if ok {
-				if eval.PWM == sa.PWM {
+			if calibrating[fid] {
+				continue // Driven by the calibration
+			}
+			if c.spinningUp(log, fid, rpms[fid]) {
+				continue // Driven by the spin-up boost
+			}
+			if retry, ok := c.retries[fid]; ok && c.now().Before(retry.at) {
+				continue // Awaiting the backoff of a failed write
+			}
+
+			if cal, ok := calibrations[fid]; ok && eval.Mode == ModePWM {
+				eval.PWM = openfan.RoundPWM(cal.Floor(eval.PWM))
+			}
+
+			boost, boosted := boosts[fid]
+			boosted = boosted && eval.Mode == ModePWM && boost > eval.PWM
+			if boosted {
+				eval.PWM = openfan.RoundPWM(boost)
+				eval.Stopped = ""
+			}
+
+			sa, ok := c.applied[fid]
+			sa.RPM = rpms[fid]
+			if ok && !c.forced[fid] {
+				if eval.Target() == sa.Target() {
 					// No change, just reset everything.
 					delete(c.pending, fid)
+					delete(c.ramps, fid)
+					delete(c.retries, fid)
 					continue
 				}
 
 				// Setup base variables for delay computing.
-				diff := eval.PWM - sa.PWM
+				diff := eval.Target() - sa.Target()
 				d := c.fans[fid].FanSetUp.Duration
 				if diff < 0 {
 					d = c.fans[fid].FanSetDown.Duration
 				}
 
-				// Do we need to await certain time before updating PWM?
-				if d > 0 {
+				// Do we need to await certain time before updating PWM? Boosts and ramps in progress are applied right away.
+				if d > 0 && !boosted && !c.ramping(fid, diff) {
 					sp, ok := c.pending[fid]
-					if !ok {
-						// First change, store for later
+					if !ok || (sp.Target() > sa.Target()) != (diff > 0) {
+						// First change or change of direction, store for later
 						c.pending[fid] = eval
 						continue
 					}
 
+					// The pending value is the one sustained since the first change.
+					if (diff > 0 && eval.Target() < sp.Target()) || (diff < 0 && eval.Target() > sp.Target()) {
+						first := sp.EvaluedAt
+						sp = eval
+						sp.EvaluedAt = first
+						c.pending[fid] = sp
+					}
+
 					if eval.EvaluedAt.Sub(sp.EvaluedAt) < d {
 						// Still awaiting the sepcified delay, await next iteration.
 						continue
 					}
 
-					// Delay reached, reset the map and update PWM.
-					delete(c.pending, fid)
+					// Delay reached, the pending value is reset once the write is confirmed.
+					eval = sp
+				}
+
+				if !boosted {
+					eval = c.ramp(fid, eval, sa)
 				}
 			}
 
-			toRefresh = true
-			c.events <- event{name: eventUpdateEval, eval: eval}
+			eval, kicking[fid] = c.kickStart(fid, eval, sa, ok, calibrations)
+			batches[fid.Controller] = append(batches[fid.Controller], eval)
+		}
 
-			log.Infof("Set PWM %d for fan%d(%s) on %s of %.0f°C", eval.PWM, eval.ID+1, eval.Label, strconv.Quote(eval.TemperatureName), eval.Temperature)
-			_, err := c.fan.SetPWM(fid, eval.PWM)
-			if err != nil {
-				log.WithError(err).Errorf("Could not set PWN for fan%d", fid)
-				continue
+		if len(batches) == 0 {
+			continue
+		}
+
+		// Write phase, controllers are written concurrently.
+		start := time.Now()
+		confirmed := make(map[string][]Evaluation, len(batches))
+		latencies := make(map[string]time.Duration, len(batches))
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for name, batch := range batches {
+			shared := c.sharedPWM(name, batch, calibrating)
+			wg.Go(func() {
+				start := time.Now()
+				evals := c.writeBatch(log, name, batch, shared)
+				latency := time.Since(start)
+				log.Debugf("Wrote %d fans of %s in %s", len(batch), name, latency)
+
+				mu.Lock()
+				confirmed[name] = evals
+				latencies[name] = latency
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+
+		for name, latency := range latencies {
+			c.events <- event{name: eventUpdateLatency, status: ControllerStatus{Name: name, WriteLatency: latency}}
+		}
+
+		if elapsed := time.Since(start); elapsed > c.polling {
+			log.Warnf("Writing fan speeds took %s, more than the polling interval of %s", elapsed, c.polling)
+		}
+
+		for name, batch := range batches {
+			for _, eval := range batch {
+				fid := eval.Channel()
+				if slices.ContainsFunc(confirmed[name], func(e Evaluation) bool { return e.Channel() == fid }) {
+					delete(c.retries, fid)
+					continue
+				}
+
+				// active is left untouched so the write is retried after a backoff.
+				retry := c.retries[fid]
+				retry.backoff = min(max(2*retry.backoff, writeBackoff), writeMaxBackoff)
+				retry.at = c.now().Add(retry.backoff)
+				c.retries[fid] = retry
+				c.events <- event{name: eventWriteFailure, channel: fid}
+				log.Warnf("Retrying write for %s in %s", fid, retry.backoff)
 			}
 		}
 
-		if !toRefresh {
-			continue
+		for _, evals := range confirmed {
+			for _, eval := range evals {
+				delete(c.pending, eval.Channel())
+				delete(c.forced, eval.Channel())
+				if eval.RampTarget != nil {
+					c.ramps[eval.Channel()] = rampStep{at: c.now(), up: *eval.RampTarget > eval.PWM}
+				} else {
+					delete(c.ramps, eval.Channel())
+				}
+				if eval.Stopped != "" && c.applied[eval.Channel()].Target() > 0 {
+					log.Infof("Stopped %s(%s): %s", eval.Channel(), eval.Label, eval.Stopped)
+				}
+				if kicking[eval.Channel()] {
+					log.Infof("Spinning up %s(%s)", eval.Channel(), eval.Label)
+					c.kicks[eval.Channel()] = kickStart{since: c.now()}
+				}
+				c.applied[eval.Channel()] = eval
+				c.events <- event{name: eventUpdateEval, eval: eval}
+			}
 		}
 
 		refreshCh <- refresh{interval: 500 * time.Millisecond, until: 8} // 8 events over 4s should be enough for Fans to change their speed.
 	}
 }
 
+// writeBatch writes the evaluations of one controller and returns the confirmed ones.
+// A single CommandFanSetAllPWM is sent when the PWM is shared by every channel of the controller.
+func (c *Controller) writeBatch(log logger.Logger, name string, batch []Evaluation, shared bool) []Evaluation {
+	if broadcaster, ok := c.controllers[name].(pwmBroadcaster); ok && shared {
+		eval := batch[0]
+		log.Infof("Set PWM %.1f for all fans of %s", eval.PWM, name)
+
+		tolerance := c.pwmTolerance(eval.Channel()) // Learned from the previous writes, not from the checked one
+		pwm, err := broadcaster.SetAllPWM(eval.PWM)
+		if err == nil && (pwm < eval.PWM-tolerance || pwm > eval.PWM+tolerance) {
+			err = fmt.Errorf("controller applied PWM %.1f instead of %.1f", pwm, eval.PWM)
+		}
+		if err == nil {
+			return batch
+		}
+
+		log.WithError(err).Warnf("Could not set PWM for all fans of %s, falling back on per-fan writes", name)
+	}
+
+	var confirmed []Evaluation
+	for _, eval := range batch {
+		if err := c.write(log, eval.Channel(), eval); err != nil {
+			log.WithError(err).Errorf("Could not set %s for %s", strings.ToUpper(eval.Mode), eval.Channel())
+			continue
+		}
+
+		confirmed = append(confirmed, eval)
+	}
+
+	return confirmed
+}
+
+// sharedPWM returns true when the batch sets the same PWM on every channel of the controller.
+// The channels out of the batch must be fans which confirmed PWM is already the same.
+func (c *Controller) sharedPWM(name string, batch []Evaluation, calibrating map[Channel]bool) bool {
+	pwm := batch[0].PWM
+	batched := map[openfan.Fan]bool{}
+	for _, eval := range batch {
+		if eval.Mode != ModePWM || eval.PWM != pwm {
+			return false
+		}
+		batched[eval.ID] = true
+	}
+
+	for i := range c.channels[name] {
+		fid := Channel{Controller: name, Fan: openfan.Fan(i)}
+		if batched[fid.Fan] {
+			continue
+		}
+
+		applied, ok := c.applied[fid]
+		if !ok || calibrating[fid] || applied.Mode != ModePWM || applied.PWM != pwm {
+			return false // Unmanaged, driven elsewhere or at another speed
+		}
+	}
+
+	return true
+}
+
+// write sends the evaluation to the controller and reads back the applied value.
+// Failed or mismatched writes are retried by the next evaluations, after a backoff.
+func (c *Controller) write(log logger.Logger, fid Channel, eval Evaluation) error {
+	controller := c.controllers[fid.Controller]
+
+	if eval.Mode == ModeRPM {
+		log.Infof("Set RPM %d for %s(%s) on %s of %.0f°C", eval.TargetRPM, fid, eval.Label, strconv.Quote(eval.TemperatureName), eval.Temperature)
+		tach := c.fans[fid].Tach
+		rpm, err := controller.SetRPM(fid.Fan, tach.Reported(eval.TargetRPM))
+		if err == nil && rpm != tach.Reported(eval.TargetRPM) {
+			err = fmt.Errorf("controller applied RPM %d instead of %d", tach.RPM(rpm), eval.TargetRPM)
+		}
+		return err
+	}
+
+	log.Infof("Set PWM %.1f for %s(%s) on %s of %.0f°C", eval.PWM, fid, eval.Label, strconv.Quote(eval.TemperatureName), eval.Temperature)
+	tolerance := c.pwmTolerance(fid) // Learned from the previous writes, not from the checked one
+	pwm, err := controller.SetPWM(fid.Fan, eval.PWM)
+	if err == nil && (pwm < eval.PWM-tolerance || pwm > eval.PWM+tolerance) {
+		err = fmt.Errorf("controller applied PWM %.1f instead of %.1f", pwm, eval.PWM)
+	}
+	return err
+}
+
+// pwmTolerance returns the difference allowed between the written PWM and the one applied by the controller.
+func (c *Controller) pwmTolerance(fid Channel) float64 {
+	if resolver, ok := c.controllers[fid.Controller].(pwmResolver); ok {
+		return max(pwmTolerance, resolver.PWMResolution(fid.Fan))
+	}
+	return pwmTolerance
+}
+
 func (c *Controller) monitor(log logger.Logger) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Info("Client connected")
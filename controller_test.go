@@ -0,0 +1,320 @@
+package openfand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+// A recorder is an OpenFan recording the written PWMs.
+type recorder struct {
+	sync   sync.Mutex
+	writes map[openfan.Fan][]float64
+}
+
+func (r *recorder) RPMs() (map[openfan.Fan]uint16, error) { return nil, nil }
+
+func (r *recorder) SetPWM(f openfan.Fan, pwm float64) (float64, error) {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	r.writes[f] = append(r.writes[f], pwm)
+	return pwm, nil
+}
+
+func (r *recorder) SetRPM(f openfan.Fan, rpm uint16) (uint16, error) { return rpm, nil }
+
+func (r *recorder) Channels() (int, error) { return 10, nil }
+
+func (r *recorder) written(f openfan.Fan) []float64 {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	return append([]float64(nil), r.writes[f]...)
+}
+
+// A clock is the deterministic clock of the eval goroutine.
+type clock struct {
+	sync sync.Mutex
+	now  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Set(seconds int) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.now = time.Unix(int64(seconds), 0)
+}
+
+// evaluator runs the eval goroutine of a Controller driving the given fans on a recorder.
+func evaluator(t *testing.T, clk *clock, fans ...Fan) (*Controller, *recorder, func(evals ...Evaluation)) {
+	t.Helper()
+
+	rec := &recorder{writes: map[openfan.Fan][]float64{}}
+	c := &Controller{
+		controllers:  map[string]OpenFan{DefaultController: rec},
+		channels:     map[string]int{DefaultController: 10},
+		events:       make(chan event, 10),
+		polling:      time.Second,
+		now:          clk.Now,
+		fans:         map[Channel]Fan{},
+		active:       map[Channel]Evaluation{},
+		applied:      map[Channel]Evaluation{},
+		pending:      map[Channel]Evaluation{},
+		rpms:         map[Channel]uint16{},
+		calibrating:  map[Channel]bool{},
+		calibrations: map[Channel]Calibration{},
+		forced:       map[Channel]bool{},
+		kicks:        map[Channel]kickStart{},
+		ramps:        map[Channel]rampStep{},
+		retries:      map[Channel]writeRetry{},
+	}
+	for _, fan := range fans {
+		c.fans[fan.Channel()] = fan
+	}
+
+	ch := make(chan map[Channel]Evaluation)
+	refreshCh := make(chan refresh, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-c.events:
+			case <-refreshCh:
+			case <-done:
+				return
+			}
+		}
+	}()
+	go c.eval(logger.NewNullLogger(), ch, refreshCh)
+	t.Cleanup(func() {
+		close(ch)
+		close(done)
+	})
+
+	tick := func(evals ...Evaluation) {
+		m := map[Channel]Evaluation{}
+		for _, eval := range evals {
+			m[eval.Channel()] = eval
+		}
+
+		ch <- m
+		ch <- map[Channel]Evaluation{} // Received once the previous evaluation is done
+	}
+
+	return c, rec, tick
+}
+
+func TestEvalSustainedPending(t *testing.T) {
+	fan := Fan{
+		Controller: DefaultController,
+		ID:         0,
+		Mode:       ModePWM,
+		FanSetUp:   Duration{Duration: 4 * time.Second},
+		FanSetDown: Duration{Duration: 4 * time.Second},
+	}
+	c, rec, tick := evaluator(t, &clock{}, fan)
+
+	start := time.Unix(0, 0)
+	eval := func(seconds int, pwm float64) Evaluation {
+		return Evaluation{
+			Controller: fan.Controller,
+			ID:         fan.ID,
+			Mode:       ModePWM,
+			PWM:        pwm,
+			EvaluedAt:  start.Add(time.Duration(seconds) * time.Second),
+		}
+	}
+
+	for i, step := range []struct {
+		eval    Evaluation
+		written []float64
+	}{
+		{eval: eval(0, 40), written: []float64{40}}, // First evaluation applied right away
+		{eval: eval(1, 60), written: []float64{40}}, // Pending
+		{eval: eval(2, 50), written: []float64{40}}, // Lower, the sustained value since the first change
+		{eval: eval(3, 70), written: []float64{40}},
+		{eval: eval(5, 65), written: []float64{40, 50}}, // Delay reached, the sustained value is applied
+		{eval: eval(6, 30), written: []float64{40, 50}},
+		{eval: eval(7, 55), written: []float64{40, 50}}, // Change of direction, the delay starts over
+		{eval: eval(10, 55), written: []float64{40, 50}},
+		{eval: eval(11, 60), written: []float64{40, 50, 55}},
+		{eval: eval(12, 70), written: []float64{40, 50, 55}},
+		{eval: eval(13, 55), written: []float64{40, 50, 55}}, // Back to the applied value, the pending one is dropped
+		{eval: eval(14, 70), written: []float64{40, 50, 55}},
+		{eval: eval(17, 70), written: []float64{40, 50, 55}},
+		{eval: eval(18, 70), written: []float64{40, 50, 55, 70}},
+	} {
+		tick(step.eval)
+
+		got := rec.written(fan.ID)
+		if len(got) != len(step.written) || got[len(got)-1] != step.written[len(step.written)-1] {
+			t.Fatalf("step %d: %.0f%% at %s: got writes %v, want %v", i, step.eval.PWM, step.eval.EvaluedAt.Sub(start), got, step.written)
+		}
+	}
+
+	if len(c.pending) != 0 {
+		t.Errorf("no value should be pending once applied, got %v", c.pending)
+	}
+}
+
+// A quantizer is a recorder which widens its resolution from the written PWMs, like a driver ignoring the writes.
+type quantizer struct {
+	*recorder
+	applied    float64
+	resolution float64
+}
+
+func (q *quantizer) SetPWM(f openfan.Fan, pwm float64) (float64, error) {
+	q.resolution = max(q.resolution, math.Abs(pwm-q.applied))
+	return q.applied, nil
+}
+
+func (q *quantizer) PWMResolution(f openfan.Fan) float64 { return q.resolution }
+
+func TestWriteTolerance(t *testing.T) {
+	q := &quantizer{recorder: &recorder{writes: map[openfan.Fan][]float64{}}, applied: 30}
+	c := &Controller{controllers: map[string]OpenFan{DefaultController: q}}
+	fid := Channel{Controller: DefaultController, Fan: 0}
+
+	// The write is checked against the resolution known before it.
+	if err := c.write(logger.NewNullLogger(), fid, Evaluation{Controller: fid.Controller, ID: fid.Fan, Mode: ModePWM, PWM: 60}); err == nil {
+		t.Error("a PWM applied 30% away should not be confirmed by its own write")
+	}
+
+	if err := c.write(logger.NewNullLogger(), fid, Evaluation{Controller: fid.Controller, ID: fid.Fan, Mode: ModePWM, PWM: 50}); err != nil {
+		t.Errorf("a PWM within the learned resolution should be confirmed: %v", err)
+	}
+}
+
+func TestEventLoopFullChannel(t *testing.T) {
+	c := &Controller{
+		events: make(chan event, 10),
+		active: map[Channel]Evaluation{},
+		alarms: map[Channel]*fanAlarms{},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.eventLoop(logger.WithLogger(context.Background(), logger.NewNullLogger()))
+		close(done)
+	}()
+
+	watcher := make(chan []byte, 200)
+	go func() {
+		c.events <- event{name: eventWatch, monitorID: 1, monitor: watcher}
+		for i := range 100 { // Keeps the channel full while the watchers are refreshed
+			c.events <- event{name: eventUpdateStatus, status: ControllerStatus{Name: fmt.Sprint(i)}}
+		}
+		close(c.events)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event loop is stuck")
+	}
+
+	if len(watcher) != 101 {
+		t.Errorf("got %d refreshes, want 101", len(watcher))
+	}
+}
+
+// A broadcaster is a recorder which sets all its channels at once.
+type broadcaster struct {
+	*recorder
+	all []float64
+	err error
+}
+
+func (b *broadcaster) SetAllPWM(pwm float64) (float64, error) {
+	b.all = append(b.all, pwm)
+	return pwm, b.err
+}
+
+func TestWriteBatch(t *testing.T) {
+	eval := func(f openfan.Fan, pwm float64) Evaluation {
+		return Evaluation{Controller: DefaultController, ID: f, Mode: ModePWM, PWM: pwm}
+	}
+
+	for name, tc := range map[string]struct {
+		batch     []Evaluation
+		applied   []Evaluation
+		err       error
+		broadcast bool
+		written   int // Per-fan writes
+	}{
+		"shared": {
+			batch:     []Evaluation{eval(0, 50), eval(1, 50), eval(2, 50)},
+			broadcast: true,
+		},
+		"shared with an applied channel": {
+			batch:     []Evaluation{eval(0, 50), eval(1, 50)},
+			applied:   []Evaluation{eval(2, 50)},
+			broadcast: true,
+		},
+		"differing targets": {
+			batch:   []Evaluation{eval(0, 50), eval(1, 60), eval(2, 50)},
+			written: 3,
+		},
+		"channel at another speed": {
+			batch:   []Evaluation{eval(0, 50), eval(1, 50)},
+			applied: []Evaluation{eval(2, 60)},
+			written: 2,
+		},
+		"unmanaged channel": {
+			batch:   []Evaluation{eval(0, 50), eval(1, 50)},
+			written: 2,
+		},
+		"broadcast error": {
+			batch:     []Evaluation{eval(0, 50), eval(1, 50), eval(2, 50)},
+			err:       errors.New("boom"),
+			broadcast: true,
+			written:   3,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := &broadcaster{recorder: &recorder{writes: map[openfan.Fan][]float64{}}, err: tc.err}
+			c := &Controller{
+				controllers: map[string]OpenFan{DefaultController: b},
+				channels:    map[string]int{DefaultController: 3},
+				applied:     map[Channel]Evaluation{},
+			}
+			for _, eval := range tc.applied {
+				c.applied[eval.Channel()] = eval
+			}
+
+			shared := c.sharedPWM(DefaultController, tc.batch, map[Channel]bool{})
+			confirmed := c.writeBatch(logger.NewNullLogger(), DefaultController, tc.batch, shared)
+
+			if len(confirmed) != len(tc.batch) {
+				t.Errorf("got %d confirmed writes, want %d", len(confirmed), len(tc.batch))
+			}
+			if broadcast := len(b.all) == 1; broadcast != tc.broadcast || len(b.all) > 1 {
+				t.Errorf("got broadcasts %v, want broadcast %v", b.all, tc.broadcast)
+			}
+
+			var written int
+			for _, writes := range b.writes {
+				written += len(writes)
+			}
+			if written != tc.written {
+				t.Errorf("got %d per-fan writes, want %d", written, tc.written)
+			}
+		})
+	}
+}
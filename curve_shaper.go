@@ -3,6 +3,7 @@ package openfand
 import (
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/mdouchement/openfand/hwmon/sensor"
@@ -15,14 +16,16 @@ var (
 )
 
 type CurveShaper struct {
-	labels map[openfan.Fan]string
-	index  map[sensor.TemperatureID]map[openfan.Fan]func(t float64) int
+	labels map[Channel]string
+	modes  map[Channel]string
+	index  map[sensor.TemperatureID]map[Channel]func(t float64) float64
 }
 
 func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error) {
 	s := &CurveShaper{
-		labels: make(map[openfan.Fan]string),
-		index:  make(map[sensor.TemperatureID]map[openfan.Fan]func(t float64) int),
+		labels: make(map[Channel]string),
+		modes:  make(map[Channel]string),
+		index:  make(map[sensor.TemperatureID]map[Channel]func(t float64) float64),
 	}
 
 	findID := func(name string) (sensor.TemperatureID, error) {
@@ -38,7 +41,8 @@ func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error
 	//
 
 	for _, fan := range cfg.FanSettings {
-		s.labels[fan.ID] = fan.Label
+		s.labels[fan.Channel()] = fan.Label
+		s.modes[fan.Channel()] = fan.Mode
 		indexp := map[sensor.TemperatureID][]point{}
 
 		for i, p := range fan.CurvePoints {
@@ -51,18 +55,27 @@ func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error
 
 					if i == 0 {
 						// Setup the start of the curve with the first PWM defined in fan's the config.
-						indexp[tid] = append(indexp[tid], point{temperature: 0, pwm: pwm})
+						indexp[tid] = append(indexp[tid], point{temperature: 0, value: pwm})
 					}
 
-					indexp[tid] = append(indexp[tid], point{temperature: float64(t), pwm: pwm})
+					indexp[tid] = append(indexp[tid], point{temperature: t, value: pwm})
 				}
 			}
 		}
 
+		// Values are clamped to 100% for PWM curves, RPM curves have no other limit than the fan itself.
+		maxValue := 100.0
+		if fan.Mode == ModeRPM {
+			maxValue = 0
+			for _, points := range indexp {
+				maxValue = max(maxValue, points[len(points)-1].value)
+			}
+		}
+
 		for tid, points := range indexp {
-			if p := points[len(points)-1]; p.pwm < 100 {
-				// Setup the end of the curve with the last PWM defined in fan's the config.
-				indexp[tid] = append(indexp[tid], point{temperature: p.temperature, pwm: 100})
+			if p := points[len(points)-1]; p.value < maxValue {
+				// Setup the end of the curve with the last value defined in fan's the config.
+				indexp[tid] = append(indexp[tid], point{temperature: p.temperature, value: maxValue})
 			}
 		}
 
@@ -72,7 +85,7 @@ func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error
 				lowT, highT := points[i].temperature, p.temperature
 				s := segment{
 					temperature: lowT,
-					eval:        PWMFromTempSegment(lowT, float64(points[i].pwm), highT, float64(p.pwm)),
+					eval:        ValueFromTempSegment(lowT, points[i].value, highT, p.value, maxValue),
 				}
 
 				indexs[tid] = append(indexs[tid], s)
@@ -81,18 +94,18 @@ func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error
 
 		for tid, segments := range indexs {
 			if s.index[tid] == nil {
-				s.index[tid] = make(map[openfan.Fan]func(t float64) int)
+				s.index[tid] = make(map[Channel]func(t float64) float64)
 			}
 
-			s.index[tid][fan.ID] = func(t float64) int {
+			s.index[tid][fan.Channel()] = func(t float64) float64 {
 				for i := len(segments) - 1; i >= 0; i-- {
 					s := segments[i]
 					if t >= s.temperature {
-						return int(s.eval(t))
+						return s.eval(t)
 					}
 				}
 
-				return 100 // In case of points[0] is not 0°C setting
+				return maxValue // In case of points[0] is not 0°C setting
 			}
 		}
 	}
@@ -100,44 +113,64 @@ func NewCurveShaper(cfg Config, temps []sensor.Temperature) (*CurveShaper, error
 	return s, nil
 }
 
-func (s CurveShaper) Eval(temps []sensor.Temperature) map[openfan.Fan]Evaluation {
-	pwms := map[openfan.Fan]Evaluation{}
+func (s CurveShaper) Eval(temps []sensor.Temperature) map[Channel]Evaluation {
+	pwms := map[Channel]Evaluation{}
 	for _, t := range temps {
-		for fid, eval := range s.index[t.ID] {
+		for fid := range s.index[t.ID] {
 			// Find the maximum speed for the given fan that depends on several temperature sensors.
-			pwms[fid] = maxPWM(pwms[fid], Evaluation{
-				ID:              fid,
-				EvaluedAt:       time.Now(),
-				Label:           s.labels[fid],
-				PWM:             eval(t.Temperature),
-				TemperatureID:   t.ID,
-				TemperatureName: t.Name,
-				Temperature:     t.Temperature,
-			})
+			pwms[fid] = maxPWM(pwms[fid], s.evaluate(fid, t, t.Temperature))
 		}
 	}
 
 	return pwms
 }
 
+// evaluate returns the evaluation of the fan for the temperature t, its curve being evaluated at the temperature at.
+func (s CurveShaper) evaluate(fid Channel, t sensor.Temperature, at float64) Evaluation {
+	e := Evaluation{
+		Controller:      fid.Controller,
+		ID:              fid.Fan,
+		EvaluedAt:       time.Now(),
+		Label:           s.labels[fid],
+		Mode:            s.modes[fid],
+		TemperatureID:   t.ID,
+		TemperatureName: t.Name,
+		Temperature:     t.Temperature,
+	}
+
+	eval := s.index[t.ID][fid]
+	if e.Mode == ModeRPM {
+		e.TargetRPM = uint16(math.Round(eval(at)))
+	} else {
+		e.PWM = openfan.RoundPWM(eval(at))
+	}
+
+	return e
+}
+
 func maxPWM(a, b Evaluation) Evaluation {
-	if a.PWM > b.PWM {
+	if a.Target() > b.Target() {
 		return a
 	}
 	return b
 }
 
 func PWMFromTempSegment(temp1, pwm1, temp2, pwm2 float64) func(temp float64) float64 {
+	return ValueFromTempSegment(temp1, pwm1, temp2, pwm2, 100)
+}
+
+// ValueFromTempSegment returns the linear function going through both points and clamped to maxValue.
+func ValueFromTempSegment(temp1, value1, temp2, value2, maxValue float64) func(temp float64) float64 {
 	if temp1 == temp2 {
 		// Simplify things in order to make clean a vertical slope
 		temp2 = 2
 		temp1 = 1
 	}
 
-	a := (pwm2 - pwm1) / (temp2 - temp1) // slope
-	b := pwm1 - a*temp1                  // y-intercept
+	a := (value2 - value1) / (temp2 - temp1) // slope
+	b := value1 - a*temp1                    // y-intercept
 
 	return func(temp float64) float64 {
-		return min(a*temp+b, 100)
+		return min(a*temp+b, maxValue)
 	}
 }
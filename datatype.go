@@ -1,6 +1,8 @@
 package openfand
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mdouchement/openfand/hwmon/sensor"
@@ -9,7 +11,66 @@ import (
 
 type OpenFan interface {
 	RPMs() (map[openfan.Fan]uint16, error)
-	SetPWM(f openfan.Fan, pwm int) (int, error)
+	SetPWM(f openfan.Fan, pwm float64) (float64, error)
+	SetRPM(f openfan.Fan, rpm uint16) (uint16, error)
+	Channels() (int, error)
+}
+
+// DefaultController is the name of the controller used by fans that are not prefixed by a controller name.
+const DefaultController = "default"
+
+// A Channel identifies a fan plugged on a given controller.
+type Channel struct {
+	Controller string
+	Fan        openfan.Fan
+}
+
+func (c Channel) String() string {
+	if c.Controller == DefaultController {
+		return fmt.Sprintf("fan%d", c.Fan+1)
+	}
+	return fmt.Sprintf("%s/fan%d", c.Controller, c.Fan+1)
+}
+
+func (c Channel) Compare(o Channel) int {
+	if c.Controller != o.Controller {
+		return strings.Compare(c.Controller, o.Controller)
+	}
+	return int(c.Fan) - int(o.Fan)
+}
+
+// A statusNotifier is an OpenFan that reports its connection status.
+type statusNotifier interface {
+	Status() openfan.Status
+	SetStatusHandler(fn func(openfan.Status))
+}
+
+// A fanDriver is an OpenFan which fan driver can be tuned.
+type fanDriver interface {
+	FanDriver(f openfan.Fan) (openfan.FanDriver, error)
+	SetFanDriver(f openfan.Fan, d openfan.FanDriver) error
+}
+
+// A pwmBroadcaster is an OpenFan that sets the PWM of all its channels at once.
+type pwmBroadcaster interface {
+	SetAllPWM(pwm float64) (float64, error)
+}
+
+// A pwmResolver is an OpenFan which applied PWM may be coarser than the pwmTolerance (e.g. hwmon drivers with a few speed levels).
+type pwmResolver interface {
+	PWMResolution(f openfan.Fan) float64
+}
+
+// A hardwareInspector is an OpenFan that reports its hardware.
+type hardwareInspector interface {
+	HardwareInfo() (*openfan.HardwareInfo, error)
+	FirmwareInfo() (*openfan.FirmwareInfo, error)
+}
+
+// A registerAccessor is an OpenFan which EMC2305 registers can be accessed.
+type registerAccessor interface {
+	ReadRegister(chip uint8, reg openfan.Register) (uint8, error)
+	WriteRegister(chip uint8, reg openfan.Register, v uint8) error
 }
 
 type Sensor interface {
@@ -17,18 +78,78 @@ type Sensor interface {
 }
 
 type Shaper interface {
-	Eval(temps []sensor.Temperature) map[openfan.Fan]Evaluation
+	Eval(temps []sensor.Temperature) map[Channel]Evaluation
 }
 
 type Evaluation struct {
+	Controller      string               `json:"controller"`
 	ID              openfan.Fan          `json:"id"`
 	EvaluedAt       time.Time            `json:"-"`
 	Label           string               `json:"label"`
-	PWM             int                  `json:"pwm"`
+	Mode            string               `json:"mode"`
+	PWM             float64              `json:"pwm"`
+	TargetRPM       uint16               `json:"target_rpm"`
 	RPM             uint16               `json:"rpm"`
 	TemperatureID   sensor.TemperatureID `json:"-"`
 	TemperatureName string               `json:"temperature_name"`
 	Temperature     float64              `json:"temperature"`
+	WriteFailures   int                  `json:"write_failures"` // Failed or unconfirmed writes since startup
+	Model           string               `json:"model,omitempty"`
+	MaxRPM          uint16               `json:"max_rpm,omitempty"`
+	Alarms          []string             `json:"alarms,omitempty"`      // Raised alarms
+	Stopped         string               `json:"stopped,omitempty"`     // Reason of the fan stop
+	RampTarget      *float64             `json:"ramp_target,omitempty"` // PWM reached by the ramp in progress
+}
+
+type HardwareReport struct {
+	Controller string                `json:"controller"`
+	Hardware   *openfan.HardwareInfo `json:"hardware,omitempty"`
+	Firmware   *openfan.FirmwareInfo `json:"firmware,omitempty"`
+	Error      string                `json:"error,omitempty"`
+}
+
+type RegisterValue struct {
+	Controller string           `json:"controller"`
+	Chip       uint8            `json:"chip"`
+	Register   openfan.Register `json:"register"`
+	Value      uint8            `json:"value"`
+}
+
+type ControllerStatus struct {
+	Name       string `json:"name"`
+	Port       string `json:"port"`
+	Channels   int    `json:"channels"`
+	Connected  bool   `json:"connected"`
+	Reconnects int    `json:"reconnects"`
+	Error      string `json:"error,omitempty"`
+	// WriteLatency is the duration of the last write phase on the controller.
+	WriteLatency time.Duration `json:"write_latency"`
+}
+
+// A Snapshot is the payload sent to monitors.
+type Snapshot struct {
+	Controllers []ControllerStatus `json:"controllers"`
+	Evaluations []Evaluation       `json:"evaluations"`
+}
+
+func (e Evaluation) Channel() Channel {
+	return Channel{Controller: e.Controller, Fan: e.ID}
+}
+
+// Speed returns the RPM in percent of the rated maximum RPM of the fan, or -1 when unknown.
+func (e Evaluation) Speed() float64 {
+	if e.MaxRPM == 0 {
+		return -1
+	}
+	return float64(e.RPM) * 100 / float64(e.MaxRPM)
+}
+
+// Target returns the PWM or the target RPM according the fan's mode.
+func (e Evaluation) Target() float64 {
+	if e.Mode == ModeRPM {
+		return float64(e.TargetRPM)
+	}
+	return e.PWM
 }
 
 func ToPtr[T any](v T) *T {
@@ -37,7 +158,7 @@ func ToPtr[T any](v T) *T {
 
 type point struct {
 	temperature float64
-	pwm         int
+	value       float64
 }
 
 type segment struct {
@@ -46,27 +167,58 @@ type segment struct {
 }
 
 const (
-	eventUpdateEval      = "update-eval"
-	eventUpdateRPMs      = "update-rpms"
-	eventWatch           = "watch"
-	eventRefreshWatchers = "refresh-watchers"
-	eventUnwatch         = "unwatch"
+	eventUpdateEval    = "update-eval"
+	eventUpdateRPMs    = "update-rpms"
+	eventUpdateStatus  = "update-status"
+	eventWriteFailure  = "write-failure"
+	eventUpdateLatency = "update-latency"
+	eventWatch         = "watch"
+	eventUnwatch       = "unwatch"
 )
 
 type event struct {
 	name      string
 	eval      Evaluation
-	rpms      map[openfan.Fan]uint16
+	channel   Channel
+	rpms      map[Channel]uint16
+	status    ControllerStatus
 	monitorID int64
 	monitor   chan<- []byte
 }
 
+const (
+	writeBackoff    = 100 * time.Millisecond
+	writeMaxBackoff = 10 * time.Second
+	pwmTolerance    = 0.5 // Controllers round the PWM on their duty resolution (at worst 1%)
+)
+
 type refresh struct {
 	current  uint8
 	until    uint8
 	interval time.Duration
 }
 
+// A writeRetry is the backoff of a failed write.
+type writeRetry struct {
+	at      time.Time
+	backoff time.Duration
+}
+
+func toControllerStatus(name string, channels int, s openfan.Status) ControllerStatus {
+	status := ControllerStatus{
+		Name:       name,
+		Channels:   channels,
+		Port:       s.Port,
+		Connected:  s.Connected,
+		Reconnects: s.Reconnects,
+	}
+	if s.Err != nil {
+		status.Error = s.Err.Error()
+	}
+
+	return status
+}
+
 func genID() int64 {
 	time.Sleep(time.Nanosecond)
 	return time.Now().UnixNano()
@@ -1,7 +1,9 @@
 package openfand
 
 import (
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/openfand/openfan"
@@ -9,18 +11,29 @@ import (
 
 // A DummyOpenfanController should only be used for dev & tests.
 type DummyOpenfanController struct {
-	sync sync.Mutex
-	pwms map[openfan.Fan]int
-	log  logger.Logger
+	sync    sync.Mutex
+	pwms    map[openfan.Fan]float64
+	rpms    map[openfan.Fan]uint16
+	drivers map[openfan.Fan]openfan.FanDriver
+	log     logger.Logger
 }
 
-func NewDummyOpenfanController() *DummyOpenfanController {
-	n := 10
+func NewDummyOpenfanController(n int) *DummyOpenfanController {
 	c := &DummyOpenfanController{
-		pwms: make(map[openfan.Fan]int, n),
+		pwms:    make(map[openfan.Fan]float64, n),
+		rpms:    make(map[openfan.Fan]uint16, n),
+		drivers: make(map[openfan.Fan]openfan.FanDriver, n),
 	}
 	for i := range n {
 		c.pwms[openfan.Fan(i)] = 0
+		c.drivers[openfan.Fan(i)] = openfan.FanDriver{
+			SpinUpLevel: 60,
+			SpinUpTime:  500 * time.Millisecond,
+			SpinUpKick:  true,
+			RPMRange:    1000,
+			Edges:       5,
+			MinDrive:    0x66,
+		}
 	}
 
 	return c
@@ -43,12 +56,16 @@ func (c *DummyOpenfanController) HardwareInfo() (*openfan.HardwareInfo, error) {
 		Revision:          "n/a",
 		MCU:               "n/a",
 		USB:               "n/a",
-		FanChannelsTotal:  "n/a",
+		FanChannelsTotal:  strconv.Itoa(len(c.pwms)),
 		FanChannelsArch:   "n/a",
 		FanChannelsDriver: "n/a",
 	}, nil
 }
 
+func (c *DummyOpenfanController) Channels() (int, error) {
+	return len(c.pwms), nil
+}
+
 func (c *DummyOpenfanController) FirmwareInfo() (*openfan.FirmwareInfo, error) {
 	return &openfan.FirmwareInfo{
 		Revision:        "n/a",
@@ -62,16 +79,58 @@ func (c *DummyOpenfanController) RPMs() (map[openfan.Fan]uint16, error) {
 
 	rpms := make(map[openfan.Fan]uint16, len(c.pwms))
 	for k, pwm := range c.pwms {
-		rpms[k] = uint16(1500 * float32(pwm) / 100)
+		rpms[k] = uint16(1500 * pwm / 100)
+		if rpm, ok := c.rpms[k]; ok {
+			rpms[k] = rpm
+		}
 	}
 
 	return rpms, nil
 }
 
-func (c *DummyOpenfanController) SetPWM(f openfan.Fan, pwm int) (int, error) {
+func (c *DummyOpenfanController) SetPWM(f openfan.Fan, pwm float64) (float64, error) {
 	c.sync.Lock()
 	defer c.sync.Unlock()
 
 	c.pwms[f] = pwm
+	delete(c.rpms, f)
+	return pwm, nil
+}
+
+func (c *DummyOpenfanController) SetAllPWM(pwm float64) (float64, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	for f := range c.pwms {
+		c.pwms[f] = pwm
+		delete(c.rpms, f)
+	}
 	return pwm, nil
 }
+
+func (c *DummyOpenfanController) SetRPM(f openfan.Fan, rpm uint16) (uint16, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.rpms[f] = rpm
+	return rpm, nil
+}
+
+func (c *DummyOpenfanController) FanDriver(f openfan.Fan) (openfan.FanDriver, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.drivers[f], nil
+}
+
+func (c *DummyOpenfanController) SetFanDriver(f openfan.Fan, d openfan.FanDriver) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.drivers[f] = d
+	return nil
+}
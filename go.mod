@@ -12,6 +12,7 @@ require (
 	github.com/spf13/cobra v1.10.2
 	go.bug.st/serial v1.6.4
 	go.yaml.in/yaml/v4 v4.0.0-rc.3
+	golang.org/x/sys v0.39.0
 )
 
 require (
@@ -44,7 +45,6 @@ require (
 	github.com/spf13/pflag v1.0.10 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/image v0.34.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/term v0.38.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 )
@@ -0,0 +1,191 @@
+package openfand
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+var errNotSupported = errors.New("not supported by the controller")
+
+// hardwareInfo serves the hardware and firmware info of every controller.
+func (c *Controller) hardwareInfo(log logger.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reports []HardwareReport
+
+		for _, name := range slices.Sorted(maps.Keys(c.controllers)) {
+			report := HardwareReport{Controller: name}
+
+			inspector, ok := c.controllers[name].(hardwareInspector)
+			if !ok {
+				report.Error = errNotSupported.Error()
+				reports = append(reports, report)
+				continue
+			}
+
+			var err error
+			report.Hardware, err = inspector.HardwareInfo()
+			if err == nil {
+				report.Firmware, err = inspector.FirmwareInfo()
+			}
+			if err != nil {
+				log.WithError(err).Errorf("Could not read hardware info of %s", name)
+				report.Error = err.Error()
+			}
+
+			reports = append(reports, report)
+		}
+
+		writeJSON(log, w, reports)
+	}
+}
+
+// registers serves the EMC2305 registers of a controller.
+//
+//	GET /hardware/registers?controller=name[&chip=0]
+func (c *Controller) registers(log logger.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, accessor, err := c.registerAccessor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		chips := make([]uint8, openfan.EMCChips(c.channels[name]))
+		for i := range chips {
+			chips[i] = uint8(i)
+		}
+		if r.URL.Query().Has("chip") {
+			chip, err := parseChip(r.URL.Query().Get("chip"), c.channels[name])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			chips = []uint8{chip}
+		}
+
+		var values []RegisterValue
+		for _, chip := range chips {
+			for _, reg := range openfan.EMCRegisters() {
+				v, err := accessor.ReadRegister(chip, reg)
+				if err != nil {
+					log.WithError(err).Errorf("Could not read register %02X of %s", reg, name)
+					http.Error(w, err.Error(), http.StatusBadGateway)
+					return
+				}
+
+				values = append(values, RegisterValue{Controller: name, Chip: chip, Register: reg, Value: v})
+			}
+		}
+
+		writeJSON(log, w, values)
+	}
+}
+
+// register reads or writes an EMC2305 register of a controller.
+//
+//	GET /hardware/register?controller=name&chip=0&register=0x30
+//	PUT /hardware/register?controller=name&chip=0&register=0x30&value=0xFF
+func (c *Controller) register(log logger.Logger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, accessor, err := c.registerAccessor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		value := RegisterValue{Controller: name}
+
+		value.Chip, err = parseChip(query.Get("chip"), c.channels[name])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		value.Register, err = openfan.ParseEMCRegister(query.Get("register"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if !c.registerWrites {
+				http.Error(w, "raw register writes are disabled, set `register_writes: true` in the configuration", http.StatusForbidden)
+				return
+			}
+
+			v, err := strconv.ParseUint(query.Get("value"), 0, 8)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid value %s", query.Get("value")), http.StatusBadRequest)
+				return
+			}
+
+			log.Warnf("Writing %02X to register %02X of chip %d on %s", v, value.Register, value.Chip, name)
+			err = accessor.WriteRegister(value.Chip, value.Register, uint8(v))
+			if err != nil {
+				log.WithError(err).Errorf("Could not write register %02X of %s", value.Register, name)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		value.Value, err = accessor.ReadRegister(value.Chip, value.Register)
+		if err != nil {
+			log.WithError(err).Errorf("Could not read register %02X of %s", value.Register, name)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(log, w, value)
+	}
+}
+
+// registerAccessor returns the controller of the request.
+// The controller can be omitted when only one is driven.
+func (c *Controller) registerAccessor(r *http.Request) (string, registerAccessor, error) {
+	name := r.URL.Query().Get("controller")
+	if name == "" {
+		if len(c.controllers) != 1 {
+			return "", nil, fmt.Errorf("controller must be one of %v", slices.Sorted(maps.Keys(c.controllers)))
+		}
+		name = slices.Collect(maps.Keys(c.controllers))[0]
+	}
+
+	controller, ok := c.controllers[name]
+	if !ok {
+		return "", nil, fmt.Errorf("controller %s not found", name)
+	}
+
+	accessor, ok := controller.(registerAccessor)
+	if !ok {
+		return "", nil, fmt.Errorf("%s: %w", name, errNotSupported)
+	}
+
+	return name, accessor, nil
+}
+
+func parseChip(s string, channels int) (uint8, error) {
+	chip, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || int(chip) >= openfan.EMCChips(channels) {
+		return 0, fmt.Errorf("invalid chip %q", s)
+	}
+
+	return uint8(chip), nil
+}
+
+func writeJSON(log logger.Logger, w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.WithError(err).Error("Could not write JSON payload")
+	}
+}
@@ -0,0 +1,246 @@
+package fan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mdouchement/openfand/hwmon/environment"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+var (
+	ErrNotFound        = errors.New("hwmon chip not found")
+	ErrRPMNotSupported = errors.New("rpm mode not supported by hwmon")
+)
+
+// pwmN_enable values (cf. https://www.kernel.org/doc/Documentation/hwmon/sysfs-interface)
+const enableManual = "1"
+
+// maxStep is the coarsest duty quantization learned from the read back duties, drivers with a few speed levels
+// (e.g. dell-smm and its 3 levels) never read back further than half a level away.
+const maxStep = 64
+
+var rePWM = regexp.MustCompile(`^pwm(\d+)$`)
+
+// A Controller drives the PWM fan headers of a hwmon chip (e.g. motherboard Super I/O or amdgpu):
+//
+//	/sys/class/hwmon/hwmonX/pwmN         duty 0-255
+//	/sys/class/hwmon/hwmonX/pwmN_enable  0: full speed, 1: manual, 2+: automatic (driver specific)
+//	/sys/class/hwmon/hwmonX/fanN_input   RPM
+type Controller struct {
+	sync     sync.Mutex
+	dir      string
+	channels int
+	enables  map[openfan.Fan]string // Original pwmN_enable of the channels taken under manual control
+	steps    map[openfan.Fan]uint8  // Duty quantization observed on the channels
+}
+
+// Open opens the hwmon chip matching the given name.
+// The name is the hwmon directory (e.g. hwmon3), the driver name (e.g. nct6798) or the device name.
+func Open(chip string) (*Controller, error) {
+	dirs, err := filepath.Glob(environment.GetEnvPath(environment.KeyHostSys, "/sys", "/class/hwmon/hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if filepath.Base(dir) != chip && readString(filepath.Join(dir, "name")) != chip && getDeviceName(filepath.Join(dir, "device")) != chip {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "pwm*"))
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Controller{
+			dir:     dir,
+			enables: make(map[openfan.Fan]string),
+			steps:   make(map[openfan.Fan]uint8),
+		}
+		for _, file := range files {
+			match := rePWM.FindStringSubmatch(filepath.Base(file))
+			if len(match) != 2 {
+				continue
+			}
+
+			n, _ := strconv.Atoi(match[1])
+			c.channels = max(c.channels, n)
+		}
+
+		if c.channels == 0 {
+			return nil, fmt.Errorf("%s: no pwm channel", chip)
+		}
+
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", chip, ErrNotFound)
+}
+
+func (c *Controller) Port() string {
+	return c.dir
+}
+
+func (c *Controller) Channels() (int, error) {
+	return c.channels, nil
+}
+
+func (c *Controller) RPMs() (map[openfan.Fan]uint16, error) {
+	rpms := make(map[openfan.Fan]uint16, c.channels)
+	for i := range c.channels {
+		f := openfan.Fan(i)
+
+		file := c.path("fan%d_input", f)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue // PWM header without tachometer
+		}
+
+		v, err := readUint(file)
+		if err != nil {
+			return rpms, err
+		}
+
+		rpms[f] = uint16(min(v, math.MaxUint16))
+	}
+
+	return rpms, nil
+}
+
+func (c *Controller) SetPWM(f openfan.Fan, pwm float64) (float64, error) {
+	if pwm < 0 || pwm > 100 {
+		return 0, openfan.ErrInvalidPWM
+	}
+	if int(f) >= c.channels {
+		return 0, fmt.Errorf("pwm%d: invalid channel", f+1)
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	if err := c.manual(f); err != nil {
+		return 0, err
+	}
+
+	file := c.path("pwm%d", f)
+	duty := openfan.DutyFromPWM(pwm)
+	err := os.WriteFile(file, []byte(strconv.Itoa(int(duty))), 0o644)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := readUint(file)
+	if err != nil {
+		return 0, err
+	}
+
+	// Some drivers only have a few speed levels (e.g. dell-smm), the duty is read back on the closest one.
+	// A further duty or a channel no longer in manual mode means the write was ignored, it is not a quantization.
+	applied := uint8(min(v, 255))
+	if step := max(applied, duty) - min(applied, duty); step <= maxStep && c.controlled(f) {
+		c.steps[f] = max(c.steps[f], step)
+	}
+
+	return openfan.PWMFromDuty(applied), nil
+}
+
+// PWMResolution returns the largest quantization observed between a written PWM and the one applied by the driver.
+func (c *Controller) PWMResolution(f openfan.Fan) float64 {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return openfan.PWMFromDuty(max(c.steps[f], 1))
+}
+
+func (c *Controller) SetRPM(f openfan.Fan, rpm uint16) (uint16, error) {
+	return 0, ErrRPMNotSupported
+}
+
+// Close gives the channels back to their original mode (e.g. the motherboard automatic control).
+func (c *Controller) Close() error {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	var errs []error
+	for f, enable := range c.enables {
+		err := os.WriteFile(c.path("pwm%d_enable", f), []byte(enable), 0o644)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		delete(c.enables, f)
+	}
+
+	return errors.Join(errs...)
+}
+
+// manual takes the manual control of the channel, the original mode is saved to be restored on Close.
+// It must be called with the lock held.
+func (c *Controller) manual(f openfan.Fan) error {
+	if _, ok := c.enables[f]; ok {
+		return nil
+	}
+
+	file := c.path("pwm%d_enable", f)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil // Always in manual mode
+	}
+
+	enable := readString(file)
+	if enable != enableManual {
+		if err := os.WriteFile(file, []byte(enableManual), 0o644); err != nil {
+			return err
+		}
+	}
+
+	c.enables[f] = enable
+	return nil
+}
+
+// controlled returns true when the channel is still under manual control.
+func (c *Controller) controlled(f openfan.Fan) bool {
+	if _, ok := c.enables[f]; !ok {
+		return true // Without pwmN_enable
+	}
+	return readString(c.path("pwm%d_enable", f)) == enableManual
+}
+
+func (c *Controller) path(format string, f openfan.Fan) string {
+	return filepath.Join(c.dir, fmt.Sprintf(format, f+1))
+}
+
+func readString(file string) string {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+func readUint(file string) (uint64, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+}
+
+func getDeviceName(directory string) string {
+	for _, file := range []string{"name", "model"} {
+		if name := readString(filepath.Join(directory, file)); name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,183 @@
+package fan_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/openfand/hwmon/environment"
+	"github.com/mdouchement/openfand/hwmon/fan"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+// sysfs creates a fake /sys tree with the given hwmon files.
+func sysfs(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	t.Setenv(environment.KeyHostSys, root)
+
+	for name, content := range files {
+		file := filepath.Join(root, "class", "hwmon", name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return filepath.Join(root, "class", "hwmon")
+}
+
+func read(t *testing.T, file string) string {
+	t.Helper()
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func TestOpen(t *testing.T) {
+	sysfs(t, map[string]string{
+		"hwmon0/name":        "k10temp",
+		"hwmon0/temp1_input": "42000",
+		"hwmon1/name":        "nct6798",
+		"hwmon1/pwm1":        "128",
+		"hwmon1/pwm3":        "128",
+		"hwmon1/pwm3_enable": "5",
+		"hwmon2/name":        "amdgpu",
+		"hwmon2/device/name": "navi31",
+		"hwmon2/pwm1":        "0",
+	})
+
+	for _, chip := range []string{"hwmon1", "nct6798"} {
+		c, err := fan.Open(chip)
+		if err != nil {
+			t.Fatalf("%s: %v", chip, err)
+		}
+		if n, _ := c.Channels(); n != 3 {
+			t.Errorf("%s: got %d channels, want 3", chip, n)
+		}
+	}
+
+	c, err := fan.Open("navi31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(c.Port()) != "hwmon2" {
+		t.Errorf("got %s, want hwmon2", c.Port())
+	}
+
+	if _, err = fan.Open("k10temp"); err == nil {
+		t.Error("a chip without pwm channel should not be opened")
+	}
+
+	if _, err = fan.Open("it8688"); !errors.Is(err, fan.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, fan.ErrNotFound)
+	}
+}
+
+func TestRPMs(t *testing.T) {
+	sysfs(t, map[string]string{
+		"hwmon1/name":       "nct6798",
+		"hwmon1/pwm1":       "128",
+		"hwmon1/pwm2":       "128",
+		"hwmon1/pwm3":       "128",
+		"hwmon1/fan1_input": "1200",
+		"hwmon1/fan3_input": "0",
+	})
+
+	c, err := fan.Open("nct6798")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpms, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpms) != 2 || rpms[0] != 1200 || rpms[2] != 0 {
+		t.Errorf("got %v, want map[0:1200 2:0]", rpms)
+	}
+	if _, ok := rpms[1]; ok {
+		t.Error("a header without tachometer should not be reported")
+	}
+
+	if _, err = c.SetRPM(0, 1000); !errors.Is(err, fan.ErrRPMNotSupported) {
+		t.Errorf("got %v, want %v", err, fan.ErrRPMNotSupported)
+	}
+}
+
+func TestSetPWM(t *testing.T) {
+	dir := sysfs(t, map[string]string{
+		"hwmon1/name":        "nct6798",
+		"hwmon1/pwm1":        "255",
+		"hwmon1/pwm1_enable": "5", // SmartFan IV
+		"hwmon1/pwm2":        "255",
+		"hwmon1/pwm2_enable": "1",
+		"hwmon1/pwm3":        "255", // No pwm3_enable
+	})
+
+	c, err := fan.Open("nct6798")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for f := range openfan.Fan(3) {
+		pwm, err := c.SetPWM(f, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := openfan.RoundPWM(40); pwm != want {
+			t.Errorf("pwm%d: got %.2f, want %.2f", f+1, pwm, want)
+		}
+		if got, want := read(t, filepath.Join(dir, "hwmon1", fmt.Sprintf("pwm%d", f+1))), "102"; got != want {
+			t.Errorf("pwm%d: got duty %s, want %s", f+1, got, want)
+		}
+	}
+
+	if got, want := c.PWMResolution(0), openfan.PWMFromDuty(1); got != want {
+		t.Errorf("resolution: got %.2f, want %.2f", got, want)
+	}
+
+	if got := read(t, filepath.Join(dir, "hwmon1/pwm1_enable")); got != "1" {
+		t.Errorf("pwm1_enable: got %s, want manual mode", got)
+	}
+
+	// The board switches the channel back to automatic, it is not saved again.
+	if err = os.WriteFile(filepath.Join(dir, "hwmon1/pwm1_enable"), []byte("2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.SetPWM(0, 60); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.SetPWM(0, 101); !errors.Is(err, openfan.ErrInvalidPWM) {
+		t.Errorf("got %v, want %v", err, openfan.ErrInvalidPWM)
+	}
+	if _, err = c.SetPWM(3, 50); err == nil {
+		t.Error("pwm4 should be an invalid channel")
+	}
+
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"pwm1_enable": "5",
+		"pwm2_enable": "1",
+	} {
+		if got := read(t, filepath.Join(dir, "hwmon1", file)); got != want {
+			t.Errorf("%s: got %s, want %s restored", file, got, want)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "hwmon1/pwm3_enable")); !os.IsNotExist(err) {
+		t.Error("pwm3_enable should not be created")
+	}
+}
@@ -0,0 +1,62 @@
+package openfand
+
+import (
+	"github.com/mdouchement/openfand/hwmon/sensor"
+)
+
+// HysteresisShaper evaluates the curves of the fans with a temperature hysteresis.
+// The speed raised by a temperature is only lowered once the temperature falls the hysteresis below it.
+type HysteresisShaper struct {
+	curves  *CurveShaper
+	bands   map[Channel]float64
+	sensors map[Channel]map[string]float64
+	peaks   map[Channel]map[sensor.TemperatureID]float64 // Temperatures that raised the speed
+}
+
+func NewHysteresisShaper(cfg Config, curves *CurveShaper) *HysteresisShaper {
+	s := &HysteresisShaper{
+		curves:  curves,
+		bands:   make(map[Channel]float64),
+		sensors: make(map[Channel]map[string]float64),
+		peaks:   make(map[Channel]map[sensor.TemperatureID]float64),
+	}
+
+	for _, fan := range cfg.FanSettings {
+		s.bands[fan.Channel()] = fan.Hysteresis
+		s.sensors[fan.Channel()] = fan.SensorHysteresis
+		s.peaks[fan.Channel()] = make(map[sensor.TemperatureID]float64)
+	}
+
+	return s
+}
+
+func (s *HysteresisShaper) Eval(temps []sensor.Temperature) map[Channel]Evaluation {
+	pwms := map[Channel]Evaluation{}
+	for _, t := range temps {
+		for fid := range s.curves.index[t.ID] {
+			pwms[fid] = maxPWM(pwms[fid], s.curves.evaluate(fid, t, s.hold(fid, t)))
+		}
+	}
+
+	return pwms
+}
+
+// hold returns the temperature at which the curve of the fan is evaluated.
+func (s *HysteresisShaper) hold(fid Channel, t sensor.Temperature) float64 {
+	band, ok := s.sensors[fid][t.Name]
+	if !ok {
+		band = s.bands[fid]
+	}
+	if band <= 0 {
+		return t.Temperature
+	}
+
+	peak, ok := s.peaks[fid][t.ID]
+	if !ok || t.Temperature >= peak || t.Temperature <= peak-band {
+		// Rising, or fallen enough to lower the speed.
+		s.peaks[fid][t.ID] = t.Temperature
+		return t.Temperature
+	}
+
+	return peak
+}
@@ -0,0 +1,125 @@
+package openfand
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdouchement/openfand/hwmon/sensor"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+var (
+	cpu = sensor.Temperature{ID: 1, Name: "cpu"}
+	gpu = sensor.Temperature{ID: 2, Name: "gpu"}
+)
+
+// loadConfig loads the given YAML configuration.
+func loadConfig(t *testing.T, raw string) Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "openfand.yml")
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func at(s sensor.Temperature, v float64) []sensor.Temperature {
+	s.Temperature = v
+	return []sensor.Temperature{s}
+}
+
+// curvePWM is the PWM of the test curve: 20% up to 30°C then 2% per °C.
+func curvePWM(t float64) float64 {
+	return openfan.RoundPWM(20 + (t-30)*2)
+}
+
+const hysteresisConfig = `
+fan_settings:
+  fan1:
+    hysteresis: 3
+    sensor_hysteresis:
+      gpu: 6
+    curve_points: &curve
+      - 20%:
+          cpu: 30
+          gpu: 30
+      - 80%:
+          cpu: 60
+          gpu: 60
+  fan2:
+    curve_points: *curve
+`
+
+func TestHysteresis(t *testing.T) {
+	cfg := loadConfig(t, hysteresisConfig)
+	curves, err := NewCurveShaper(cfg, []sensor.Temperature{cpu, gpu})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewHysteresisShaper(cfg, curves)
+
+	banded := Channel{Controller: DefaultController, Fan: 0}
+	unbanded := Channel{Controller: DefaultController, Fan: 1}
+
+	for i, step := range []struct {
+		temperature float64
+		banded      float64 // Temperature at which the curve of the banded fan is evaluated
+	}{
+		{temperature: 50, banded: 50},
+		{temperature: 49, banded: 50},
+		{temperature: 50, banded: 50},
+		{temperature: 48, banded: 50},
+		{temperature: 47.5, banded: 50},
+		{temperature: 47, banded: 47}, // Fallen by the band
+		{temperature: 46, banded: 47},
+		{temperature: 47, banded: 47},
+		{temperature: 48, banded: 48}, // Rising
+		{temperature: 46, banded: 48},
+		{temperature: 45, banded: 45},
+	} {
+		evals := s.Eval(at(cpu, step.temperature))
+
+		if got, want := evals[banded].PWM, curvePWM(step.banded); got != want {
+			t.Errorf("step %d: %.1f°C: banded fan: got PWM %.1f, want %.1f", i, step.temperature, got, want)
+		}
+		if got, want := evals[unbanded].PWM, curvePWM(step.temperature); got != want {
+			t.Errorf("step %d: %.1f°C: fan without band: got PWM %.1f, want %.1f", i, step.temperature, got, want)
+		}
+		if got := evals[banded].Temperature; got != step.temperature {
+			t.Errorf("step %d: the measured temperature %.1f must be reported, got %.1f", i, step.temperature, got)
+		}
+	}
+}
+
+func TestSensorHysteresis(t *testing.T) {
+	cfg := loadConfig(t, hysteresisConfig)
+	curves, err := NewCurveShaper(cfg, []sensor.Temperature{cpu, gpu})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewHysteresisShaper(cfg, curves)
+
+	fid := Channel{Controller: DefaultController, Fan: 0}
+
+	for i, step := range []struct {
+		temperature float64
+		held        float64
+	}{
+		{temperature: 55, held: 55},
+		{temperature: 52, held: 55}, // Beyond the fan band, within the sensor one
+		{temperature: 50, held: 55},
+		{temperature: 49, held: 49},
+	} {
+		evals := s.Eval(at(gpu, step.temperature))
+		if got, want := evals[fid].PWM, curvePWM(step.held); got != want {
+			t.Errorf("step %d: %.1f°C: got PWM %.1f, want %.1f", i, step.temperature, got, want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package openfan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	DirectionRequest  = "tx"
+	DirectionResponse = "rx"
+)
+
+var ErrReplayMismatch = errors.New("replay: request does not match the capture")
+
+// A Record is a chunk of bytes exchanged with the device.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Data      string    `json:"data"`
+}
+
+// ReadCapture reads all the records of a capture (JSON lines).
+func ReadCapture(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	codec := json.NewDecoder(r)
+	for {
+		var record Record
+		err := codec.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("capture: %w", err)
+		}
+
+		records = append(records, record)
+	}
+}
+
+// A Recorder writes the traffic of a Controller as JSON lines.
+type Recorder struct {
+	sync sync.Mutex
+	w    *bufio.Writer
+	enc  *json.Encoder
+	now  func() time.Time
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false) // Keep `<` and `>` of the protocol readable
+
+	return &Recorder{
+		w:   bw,
+		enc: enc,
+		now: time.Now,
+	}
+}
+
+func (r *Recorder) record(direction string, p []byte) error {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	err := r.enc.Encode(Record{
+		Time:      r.now(),
+		Direction: direction,
+		Data:      string(p),
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.w.Flush()
+}
+
+// SetCapture tees every request and response exchanged with the device to rec.
+func (c *Controller) SetCapture(rec *Recorder) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.capture = rec
+	if ct, ok := c.transport.(*captureTransport); ok {
+		c.setTransport(ct.Transport)
+		return
+	}
+	c.setTransport(c.transport)
+}
+
+type captureTransport struct {
+	Transport
+	rec *Recorder
+}
+
+func (t *captureTransport) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+	if n > 0 {
+		if rerr := t.rec.record(DirectionResponse, p[:n]); rerr != nil {
+			return n, fmt.Errorf("capture: %w", rerr)
+		}
+	}
+
+	return n, err
+}
+
+func (t *captureTransport) Write(p []byte) (int, error) {
+	n, err := t.Transport.Write(p)
+	if n > 0 {
+		if rerr := t.rec.record(DirectionRequest, p[:n]); rerr != nil {
+			return n, fmt.Errorf("capture: %w", rerr)
+		}
+	}
+
+	return n, err
+}
+
+// A Replay is a Transport serving the responses of a capture.
+// Each request must match the next captured one.
+type Replay struct {
+	sync    sync.Mutex
+	records []Record
+	next    int
+	pending []byte
+	timeout time.Duration
+}
+
+func NewReplay(records []Record) *Replay {
+	return &Replay{
+		records: records,
+	}
+}
+
+// Done returns true when all the captured requests have been replayed.
+func (r *Replay) Done() bool {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	for _, record := range r.records[r.next:] {
+		if record.Direction == DirectionRequest {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Replay) Write(p []byte) (int, error) {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	for r.next < len(r.records) && r.records[r.next].Direction != DirectionRequest {
+		r.next++ // Skip responses which have not been read
+	}
+	if r.next >= len(r.records) {
+		return 0, fmt.Errorf("%w: %q is beyond the end", ErrReplayMismatch, p)
+	}
+
+	captured := r.records[r.next]
+	if !bytes.Equal([]byte(captured.Data), p) {
+		return 0, fmt.Errorf("%w: %q instead of %q", ErrReplayMismatch, p, captured.Data)
+	}
+
+	for r.next++; r.next < len(r.records) && r.records[r.next].Direction == DirectionResponse; r.next++ {
+		r.pending = append(r.pending, r.records[r.next].Data...)
+	}
+
+	return len(p), nil
+}
+
+func (r *Replay) Read(p []byte) (int, error) {
+	r.sync.Lock()
+	if len(r.pending) == 0 {
+		timeout := r.timeout
+		r.sync.Unlock()
+
+		// Behave like a serial port: nothing to read until the timeout.
+		time.Sleep(timeout)
+		return 0, nil
+	}
+	defer r.sync.Unlock()
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *Replay) SetReadTimeout(t time.Duration) error {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	r.timeout = t
+	return nil
+}
+
+func (r *Replay) ResetInputBuffer() error {
+	r.sync.Lock()
+	defer r.sync.Unlock()
+
+	r.pending = nil
+	return nil
+}
+
+func (r *Replay) ResetOutputBuffer() error {
+	return nil
+}
+
+func (r *Replay) Close() error {
+	return nil
+}
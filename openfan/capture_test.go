@@ -0,0 +1,98 @@
+package openfan_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/openfan/emulator"
+)
+
+func TestReplay(t *testing.T) {
+	// Record a session with the emulator.
+	c, clk := emulate(t, emulator.Options{Logs: true})
+
+	var capture bytes.Buffer
+	c.SetCapture(openfan.NewRecorder(&capture))
+
+	if _, err := c.SetPWM(0, 40); err != nil {
+		t.Fatal(err)
+	}
+	clk.Add(time.Minute)
+	recorded, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw, err := c.HardwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay it.
+	records, err := openfan.ReadCapture(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := openfan.NewReplay(records)
+	r := openfan.New("replay", replay)
+
+	pwm, err := r.SetPWM(0, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != openfan.RoundPWM(40) {
+		t.Errorf("applied PWM: got %.2f, want %.2f", pwm, openfan.RoundPWM(40))
+	}
+
+	rpms, err := r.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpms) != len(recorded) || rpms[0] != recorded[0] || rpms[0] == 0 {
+		t.Errorf("RPMs: got %v, want %v", rpms, recorded)
+	}
+
+	replayed, err := r.HardwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *replayed != *hw {
+		t.Errorf("hardware info: got %+v, want %+v", *replayed, *hw)
+	}
+
+	if !replay.Done() {
+		t.Error("all the captured requests should have been replayed")
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	capture := `{"time":"2025-01-01T00:00:00Z","direction":"tx","data":">00\r\n"}
+{"time":"2025-01-01T00:00:00Z","direction":"rx","data":"<00|00:05DC;01:0000;\r\n"}
+`
+	records, err := openfan.ReadCapture(strings.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := openfan.NewReplay(records)
+	r := openfan.New("replay", replay)
+
+	if _, err = r.SetPWM(1, 50); !errors.Is(err, openfan.ErrReplayMismatch) {
+		t.Fatalf("got %v, want %v", err, openfan.ErrReplayMismatch)
+	}
+
+	rpms, err := r.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpms[0] != 1500 || rpms[1] != 0 {
+		t.Errorf("RPMs: got %v", rpms)
+	}
+
+	if _, err = r.RPMs(); !errors.Is(err, openfan.ErrReplayMismatch) {
+		t.Errorf("beyond the end: got %v, want %v", err, openfan.ErrReplayMismatch)
+	}
+}
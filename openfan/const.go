@@ -29,6 +29,8 @@ const (
 	CommandEMCDebugWrite Command = 0x0A
 )
 
+// Channels of a standard OpenFanController.
+// The actual number of channels is reported by the hardware (cf. HardwareInfo.Channels).
 const (
 	Fan1 Fan = iota // uint(0)
 	Fan2
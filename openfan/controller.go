@@ -2,9 +2,15 @@ package openfan
 
 import (
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,53 +20,254 @@ import (
 )
 
 var (
-	ErrNotFound   = errors.New("device not found/plugged")
-	ErrInvalidPWM = errors.New("invalid PWM value")
+	ErrNotFound     = errors.New("device not found/plugged")
+	ErrInvalidPWM   = errors.New("invalid PWM value")
+	ErrDisconnected = errors.New("device disconnected")
 )
 
 type Controller struct {
-	sync   sync.Mutex
-	pname  string
-	serial serial.Port
-	log    logger.Logger
-	wbuf   []byte
-	rbuf   []byte
+	sync      sync.Mutex
+	pname     string
+	sn        string
+	transport Transport
+	dial      func() (string, Transport, error)
+	capture   *Recorder
+	log       logger.Logger
+	status    Status
+	onStatus  func(Status)
+	pwms      map[Fan]uint8
+	pwmAll    *uint8
+	rpms      map[Fan]uint16
+	drivers   map[Fan]FanDriver // Applied fan driver settings, restored on reconnection
+	done      chan struct{}
+	dec       *decoder
+	wbuf      []byte
+
+	readTimeout time.Duration
 }
 
-func OpenAuto() (*Controller, error) {
+const (
+	DefaultVID         = "2e8a"
+	DefaultPID         = "000a"
+	DefaultBaudRate    = 115200
+	DefaultReadTimeout = 200 * time.Millisecond
+)
+
+type Device struct {
+	Port         string
+	ByID         string // /dev/serial/by-id symlink of the port
+	VID          string
+	PID          string
+	SerialNumber string
+}
+
+// A DeviceConfig selects a device and configures its serial port.
+// Zero values are replaced by the defaults.
+type DeviceConfig struct {
+	// SerialNumber selects the device by its USB serial number, the device is looked up again on reconnection.
+	SerialNumber string
+	// Port selects the device by its path (e.g. /dev/ttyACM0 or a /dev/serial/by-id symlink) or URL (tcp:// or rfc2217://).
+	Port     string
+	VID      string
+	PID      string
+	BaudRate int
+	// ReadTimeout is the maximum duration of a read, the deadlines of the responses are scaled along.
+	ReadTimeout time.Duration
+}
+
+func (cfg DeviceConfig) withDefaults() DeviceConfig {
+	if cfg.VID == "" {
+		cfg.VID = DefaultVID
+	}
+	if cfg.PID == "" {
+		cfg.PID = DefaultPID
+	}
+	if cfg.BaudRate == 0 {
+		cfg.BaudRate = DefaultBaudRate
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = DefaultReadTimeout
+	}
+	return cfg
+}
+
+// Discover returns all the plugged OpenFan devices sorted by serial number.
+func Discover() ([]Device, error) {
+	return DiscoverUSB(DefaultVID, DefaultPID)
+}
+
+// DiscoverUSB returns the plugged USB serial devices matching the given VID and PID sorted by serial number and port.
+// Empty VID and PID match any USB serial device.
+func DiscoverUSB(vid, pid string) ([]Device, error) {
 	ports, err := enumerator.GetDetailedPortsList()
 	if err != nil {
 		return nil, err
 	}
 
-	var port *enumerator.PortDetails
-	for _, p := range ports {
-		if p.VID == "2e8a" && p.PID == "000a" {
-			// There are 2 entries for this match:
-			// - 2e8a 000a /dev/ttyACM0 DE645CB69B6E7933
-			// - 2e8a 000a /dev/ttyACM1 DE645CB69B6E7933
-			// Let's take the first one which is the behavior of https://github.com/SasaKaranovic/OpenFanController
-			port = p
+	byID := map[string]string{}
+	links, _ := filepath.Glob("/dev/serial/by-id/*")
+	for _, link := range links {
+		if target, err := filepath.EvalSymlinks(link); err == nil {
+			byID[target] = link
 		}
 	}
-	if port == nil {
-		return nil, ErrNotFound
+
+	slices.SortFunc(ports, func(a, b *enumerator.PortDetails) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	devices := map[string]Device{}
+	for _, p := range ports {
+		if !p.IsUSB || (vid != "" && !strings.EqualFold(p.VID, vid)) || (pid != "" && !strings.EqualFold(p.PID, pid)) {
+			continue
+		}
+
+		// There are 2 entries for each OpenFan device:
+		// - 2e8a 000a /dev/ttyACM0 DE645CB69B6E7933
+		// - 2e8a 000a /dev/ttyACM1 DE645CB69B6E7933
+		// Let's take the first one which is the behavior of https://github.com/SasaKaranovic/OpenFanController
+		// Other devices may have an empty or a shared serial number, they are identified by their port.
+		key := p.Name
+		if p.SerialNumber != "" && strings.EqualFold(p.VID, DefaultVID) && strings.EqualFold(p.PID, DefaultPID) {
+			key = p.SerialNumber
+		}
+		if _, ok := devices[key]; ok {
+			continue
+		}
+
+		devices[key] = Device{
+			Port:         p.Name,
+			ByID:         byID[p.Name],
+			VID:          p.VID,
+			PID:          p.PID,
+			SerialNumber: p.SerialNumber,
+		}
 	}
 
-	fmt.Printf("Found OpenFan on %s - PID: %s - VID: %s - SN: %s\n", port.Name, port.VID, port.PID, port.SerialNumber)
-	return Open(port.Name)
+	return slices.SortedFunc(maps.Values(devices), func(a, b Device) int {
+		return cmp.Or(strings.Compare(a.SerialNumber, b.SerialNumber), strings.Compare(a.Port, b.Port))
+	}), nil
 }
 
+// OpenAuto opens the first OpenFan device found.
+func OpenAuto() (*Controller, error) {
+	return OpenConfig(DeviceConfig{})
+}
+
+// OpenSerialNumber opens the OpenFan device that matches the given USB serial number.
+func OpenSerialNumber(sn string) (*Controller, error) {
+	return OpenConfig(DeviceConfig{SerialNumber: sn})
+}
+
+func OpenDevice(device Device) (*Controller, error) {
+	return OpenConfig(DeviceConfig{SerialNumber: device.SerialNumber, VID: device.VID, PID: device.PID})
+}
+
+// Open opens the device behind the given port, a serial device path or a tcp:// or rfc2217:// URL.
 func Open(port string) (*Controller, error) {
+	return OpenConfig(DeviceConfig{Port: port})
+}
+
+// OpenConfig opens the device selected by cfg, the first discovered one when neither a serial number nor a port is given.
+func OpenConfig(cfg DeviceConfig) (*Controller, error) {
+	cfg = cfg.withDefaults()
+	if cfg.Port != "" {
+		return open(cfg.Port, cfg)
+	}
+
+	devices, err := DiscoverUSB(cfg.VID, cfg.PID)
+	if err != nil {
+		return nil, err
+	}
+
+	i := 0
+	if cfg.SerialNumber != "" {
+		i = slices.IndexFunc(devices, func(d Device) bool {
+			return d.SerialNumber == cfg.SerialNumber
+		})
+	}
+	if i < 0 || len(devices) == 0 {
+		return nil, fmt.Errorf("%s: %w", cfg.SerialNumber, ErrNotFound)
+	}
+
+	device := devices[i]
+	fmt.Printf("Found OpenFan on %s - PID: %s - VID: %s - SN: %s\n", device.Port, device.VID, device.PID, device.SerialNumber)
+	cfg.SerialNumber = device.SerialNumber
+
+	return open(device.Port, cfg)
+}
+
+func open(port string, cfg DeviceConfig) (*Controller, error) {
+	t, err := openTransport(port, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(port, t)
+	c.sn = cfg.SerialNumber
+	c.readTimeout = cfg.ReadTimeout
+	c.dec.polling = cfg.ReadTimeout
+	c.dial = func() (string, Transport, error) {
+		if c.sn != "" {
+			// The device may have been re-enumerated on another port.
+			devices, err := DiscoverUSB(cfg.VID, cfg.PID)
+			if err != nil {
+				return "", nil, err
+			}
+
+			i := slices.IndexFunc(devices, func(d Device) bool {
+				return d.SerialNumber == c.sn
+			})
+			if i < 0 {
+				return "", nil, fmt.Errorf("%s: %w", c.sn, ErrNotFound)
+			}
+
+			port = devices[i].Port
+		}
+
+		t, err := openTransport(port, cfg)
+		return port, t, err
+	}
+
+	return c, nil
+}
+
+// New returns a Controller communicating through the given transport.
+// A Controller created this way does not reconnect on disconnection.
+func New(name string, t Transport) *Controller {
 	c := &Controller{
-		pname: port,
-		wbuf:  make([]byte, CommRxBufferLenASCII),
-		rbuf:  make([]byte, CommRxBufferLenASCII*32), // aka 4096 which is plenty (512 is enough)
+		pname:   name,
+		status:  Status{Connected: true, Port: name},
+		pwms:    make(map[Fan]uint8),
+		rpms:    make(map[Fan]uint16),
+		drivers: make(map[Fan]FanDriver),
+		done:    make(chan struct{}),
+		wbuf:    make([]byte, CommRxBufferLenASCII),
+
+		readTimeout: DefaultReadTimeout,
+	}
+	c.setTransport(t)
+
+	return c
+}
+
+// setTransport must be called with the lock held.
+func (c *Controller) setTransport(t Transport) {
+	if t != nil && c.capture != nil {
+		t = &captureTransport{Transport: t, rec: c.capture}
 	}
 
-	var err error
-	c.serial, err = serial.Open(port, &serial.Mode{
-		BaudRate: 115200,
+	c.transport = t
+	c.dec = nil
+	if t != nil {
+		c.dec = newDecoder(t)
+		c.dec.polling = c.readTimeout
+	}
+}
+
+func openSerial(port string, cfg DeviceConfig) (Transport, error) {
+	p, err := serial.Open(port, &serial.Mode{
+		BaudRate: cfg.BaudRate,
 		DataBits: 8,
 		Parity:   serial.NoParity,
 		StopBits: serial.OneStopBit,
@@ -69,17 +276,19 @@ func Open(port string) (*Controller, error) {
 		return nil, err
 	}
 
-	c.serial.SetReadTimeout(200 * time.Millisecond)
+	p.SetReadTimeout(cfg.ReadTimeout)
 
-	if err = c.serial.ResetInputBuffer(); err != nil {
+	if err = p.ResetInputBuffer(); err != nil {
+		p.Close()
 		return nil, err
 	}
 
-	if err = c.serial.ResetOutputBuffer(); err != nil {
+	if err = p.ResetOutputBuffer(); err != nil {
+		p.Close()
 		return nil, err
 	}
 
-	return c, nil
+	return p, nil
 }
 
 func (c *Controller) SetLogger(l logger.Logger) {
@@ -87,21 +296,41 @@ func (c *Controller) SetLogger(l logger.Logger) {
 }
 
 func (c *Controller) Close() error {
-	if err := c.serial.ResetInputBuffer(); err != nil {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	select {
+	case <-c.done:
+	default:
+		close(c.done) // Stop any pending reconnection
+	}
+
+	if c.transport == nil {
+		return nil
+	}
+
+	if err := c.transport.ResetInputBuffer(); err != nil {
 		return err
 	}
 
-	if err := c.serial.ResetOutputBuffer(); err != nil {
+	if err := c.transport.ResetOutputBuffer(); err != nil {
 		return err
 	}
 
-	return c.serial.Close()
+	return c.transport.Close()
 }
 
 func (c *Controller) Port() string {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
 	return c.pname
 }
 
+func (c *Controller) SerialNumber() string {
+	return c.sn
+}
+
 func (c *Controller) HardwareInfo() (*HardwareInfo, error) {
 	response, err := c.Run(CommandHardwareInfo)
 	if err != nil {
@@ -134,6 +363,16 @@ func (c *Controller) HardwareInfo() (*HardwareInfo, error) {
 	return &hw, nil
 }
 
+// Channels returns the number of fan channels of the device.
+func (c *Controller) Channels() (int, error) {
+	hw, err := c.HardwareInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	return hw.Channels()
+}
+
 func (c *Controller) FirmwareInfo() (*FirmwareInfo, error) {
 	response, err := c.Run(CommandFirmwareInfo)
 	if err != nil {
@@ -211,6 +450,11 @@ func (c *Controller) SetRPM(f Fan, rpm uint16) (uint16, error) {
 	f1, f2 := f2x(f)
 	rpm1, rpm2, rpm3, rpm4 := f4x(rpm)
 
+	c.sync.Lock()
+	c.rpms[f] = rpm // Last known target, restored on reconnection
+	delete(c.pwms, f)
+	c.sync.Unlock()
+
 	response, err := c.Run(CommandFanSetRPM, f1, f2, rpm1, rpm2, rpm3, rpm4)
 	if err != nil {
 		return 0, fmt.Errorf("fan_set_rpm: %w", err)
@@ -229,17 +473,27 @@ func (c *Controller) SetRPM(f Fan, rpm uint16) (uint16, error) {
 	return uint16(v), nil
 }
 
-func (c *Controller) SetPWM(f Fan, pwm int) (int, error) {
+// SetPWM sets the duty cycle of the fan in percent and returns the applied one.
+func (c *Controller) SetPWM(f Fan, pwm float64) (float64, error) {
 	if pwm < 0 || pwm > 100 {
 		return 0, ErrInvalidPWM
 	}
 
+	duty, err := c.SetDuty(f, DutyFromPWM(pwm))
+	return PWMFromDuty(duty), err
+}
+
+// SetDuty sets the raw 0-255 duty cycle of the fan and returns the applied one.
+func (c *Controller) SetDuty(f Fan, duty uint8) (uint8, error) {
 	f1, f2 := f2x(f)
-	pwm = pwm*255/100 + 1
-	pwm = min(pwm, 255)
-	pwm1, pwm2 := f2x(uint8(pwm))
+	duty1, duty2 := f2x(duty)
+
+	c.sync.Lock()
+	c.pwms[f] = duty // Last known PWM, restored on reconnection
+	delete(c.rpms, f)
+	c.sync.Unlock()
 
-	response, err := c.Run(CommandFanSetPWM, f1, f2, pwm1, pwm2)
+	response, err := c.Run(CommandFanSetPWM, f1, f2, duty1, duty2)
 	if err != nil {
 		return 0, fmt.Errorf("fan_set_pwm: %w", err)
 	}
@@ -254,20 +508,30 @@ func (c *Controller) SetPWM(f Fan, pwm int) (int, error) {
 		return 0, fmt.Errorf("fan_set_pwm: %w", err)
 	}
 
-	v = v * 100 / 255
-	return int(v), nil
+	return uint8(v), nil
 }
 
-func (c *Controller) SetAllPWM(pwm int) (int, error) {
+// SetAllPWM sets the duty cycle of all the fans in percent and returns the applied one.
+func (c *Controller) SetAllPWM(pwm float64) (float64, error) {
 	if pwm < 0 || pwm > 100 {
 		return 0, ErrInvalidPWM
 	}
 
-	pwm = pwm*255/100 + 1
-	pwm = min(pwm, 255)
-	pwm1, pwm2 := f2x(uint8(pwm))
+	duty, err := c.SetAllDuty(DutyFromPWM(pwm))
+	return PWMFromDuty(duty), err
+}
+
+// SetAllDuty sets the raw 0-255 duty cycle of all the fans and returns the applied one.
+func (c *Controller) SetAllDuty(duty uint8) (uint8, error) {
+	duty1, duty2 := f2x(duty)
+
+	c.sync.Lock()
+	c.pwmAll = ToPtr(duty) // Last known PWM, restored on reconnection
+	clear(c.pwms)
+	clear(c.rpms)
+	c.sync.Unlock()
 
-	response, err := c.Run(CommandFanSetAllPWM, pwm1, pwm2)
+	response, err := c.Run(CommandFanSetAllPWM, duty1, duty2)
 	if err != nil {
 		return 0, fmt.Errorf("fan_set_all_pwm: %w", err)
 	}
@@ -277,14 +541,62 @@ func (c *Controller) SetAllPWM(pwm int) (int, error) {
 		return 0, fmt.Errorf("fan_set_all_pwm: %w", err)
 	}
 
-	v = v * 100 / 255
-	return int(v), nil
+	return uint8(v), nil
+}
+
+// DutyFromPWM converts a duty cycle in percent to the nearest 0-255 raw duty.
+func DutyFromPWM(pwm float64) uint8 {
+	return uint8(math.Round(min(max(pwm, 0), 100) * 255 / 100))
+}
+
+// RoundPWM snaps a duty cycle in percent on the 8-bit duty resolution.
+func RoundPWM(pwm float64) float64 {
+	return PWMFromDuty(DutyFromPWM(pwm))
+}
+
+// PWMFromDuty converts a 0-255 raw duty to a duty cycle in percent.
+func PWMFromDuty(duty uint8) float64 {
+	return float64(duty) * 100 / 255
+}
+
+// JumpToBootLoader reboots the device into the RP2040 mass-storage bootloader.
+// The Controller is closed since the device disconnects.
+func (c *Controller) JumpToBootLoader() error {
+	c.sync.Lock()
+	_, err := c.run(CommandJumpToBootLoader) // Not exec, the disconnection is expected
+	c.sync.Unlock()
+
+	if err != nil && !errors.Is(err, ErrTimeout) && !isDisconnection(err) {
+		return fmt.Errorf("jump_to_bootloader: %w", err)
+	}
+
+	c.Close() // The device may already be gone
+	return nil
 }
 
 func (c *Controller) Run(command Command, payload ...byte) ([]byte, error) {
 	c.sync.Lock()
 	defer c.sync.Unlock()
 
+	return c.exec(command, payload...)
+}
+
+// exec runs the command and handles disconnections.
+// It must be called with the lock held.
+func (c *Controller) exec(command Command, payload ...byte) ([]byte, error) {
+	response, err := c.run(command, payload...)
+	if err != nil && isDisconnection(err) {
+		c.disconnect(err)
+	}
+
+	return response, err
+}
+
+func (c *Controller) run(command Command, payload ...byte) ([]byte, error) {
+	if c.transport == nil {
+		return nil, ErrDisconnected
+	}
+
 	l := 5 + len(payload)
 	c.wbuf[0] = CommRequestCharacter
 	c.wbuf[1], c.wbuf[2] = f2x(command)
@@ -296,7 +608,13 @@ func (c *Controller) Run(command Command, payload ...byte) ([]byte, error) {
 
 	//
 
-	n, err := c.serial.Write(c.wbuf[:l])
+	// Drop any stale bytes, e.g. a late response of a previous command.
+	c.dec.reset()
+	if err := c.transport.ResetInputBuffer(); err != nil {
+		return nil, fmt.Errorf("reset: %w", err)
+	}
+
+	n, err := c.transport.Write(c.wbuf[:l])
 	if err != nil {
 		return nil, fmt.Errorf("write: %w", err)
 	}
@@ -304,54 +622,11 @@ func (c *Controller) Run(command Command, payload ...byte) ([]byte, error) {
 		c.log.Warnf("Invalid write: %d of %d", n, l)
 	}
 
-	//
-
-	n = 0
-	i, l := 0, 0
-	for {
-		n, err = c.serial.Read(c.rbuf[n*i : CommRxBufferLenASCII+n*i])
-		if err != nil {
-			return nil, fmt.Errorf("read: %w", err)
-		}
-
-		i++
-		l += n
-		if n < CommRxBufferLenASCII {
-			break
-		}
-	}
-
-	n = bytes.IndexByte(c.rbuf, CommResponseCharacter)
-	logs := c.rbuf[:n]
-	response := c.rbuf[n:l]
-
-	//
-
-	if c.log != nil {
-		for p := range bytes.SplitSeq(logs, []byte{'\r', '\n'}) {
-			if len(p) == 0 {
-				continue
-			}
-			c.log.Debug(string(p))
-		}
-
-		for p := range bytes.SplitSeq(response, []byte{'\r', '\n'}) {
-			if len(p) == 0 {
-				continue
-			}
-			c.log.Debug(string(p))
-		}
-	}
-
-	//
-
-	if len(response) > 4 {
-		response = response[4:]
+	response, err := c.readResponse(command)
+	if err != nil {
+		c.dec.reset()
+		return nil, err
 	}
 
-	response = bytes.TrimSpace(response)
-
-	copied := make([]byte, len(response))
-	copy(copied, response)
-	return copied, nil
+	return response, nil
 }
@@ -0,0 +1,52 @@
+package openfan_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/openfan/emulator"
+)
+
+func TestControllerPTY(t *testing.T) {
+	pty, err := emulator.OpenPTY()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() { pty.Close() })
+
+	clk := &clock{now: time.Unix(0, 0)}
+	go emulator.New(emulator.Options{MaxRPM: 1500, Now: clk.Now}).Serve(pty)
+
+	c, err := openfan.Open(pty.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	pwm, err := c.SetPWM(1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != 100 {
+		t.Errorf("applied PWM: got %.2f, want 100", pwm)
+	}
+
+	clk.Add(time.Minute)
+
+	rpms, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpms[1] != 1500 {
+		t.Errorf("fan 1: got %d RPM, want 1500", rpms[1])
+	}
+
+	hw, err := c.HardwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hw.Revision != "emulator" {
+		t.Errorf("hardware info: got %+v", *hw)
+	}
+}
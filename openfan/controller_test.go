@@ -0,0 +1,241 @@
+package openfan_test
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/openfan/emulator"
+)
+
+// A clock is the deterministic clock of the emulated fans.
+type clock struct {
+	sync sync.Mutex
+	now  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// listen serves the emulators returned by next over TCP, one per connection.
+func listen(t *testing.T, next func() *emulator.Emulator) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				next().Serve(conn)
+			}()
+		}
+	}()
+
+	return "tcp://" + ln.Addr().String()
+}
+
+// emulate opens a Controller on an emulated device.
+func emulate(t *testing.T, opts emulator.Options) (*openfan.Controller, *clock) {
+	t.Helper()
+
+	clk := &clock{now: time.Unix(0, 0)}
+	opts.Now = clk.Now
+	e := emulator.New(opts)
+
+	c, err := openfan.OpenConfig(openfan.DeviceConfig{
+		Port:        listen(t, func() *emulator.Emulator { return e }),
+		ReadTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, clk
+}
+
+func TestControllerPWM(t *testing.T) {
+	c, clk := emulate(t, emulator.Options{MaxRPM: 1500})
+
+	pwm, err := c.SetPWM(2, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != openfan.RoundPWM(50) {
+		t.Errorf("applied PWM: got %.2f, want %.2f", pwm, openfan.RoundPWM(50))
+	}
+
+	pwm, err = c.SetAllPWM(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != openfan.RoundPWM(20) {
+		t.Errorf("applied PWM: got %.2f, want %.2f", pwm, openfan.RoundPWM(20))
+	}
+
+	pwm, err = c.SetPWM(2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != 100 {
+		t.Errorf("applied PWM: got %.2f, want 100", pwm)
+	}
+
+	if _, err = c.SetPWM(2, 101); !errors.Is(err, openfan.ErrInvalidPWM) {
+		t.Errorf("out of range PWM: got %v, want %v", err, openfan.ErrInvalidPWM)
+	}
+
+	clk.Add(time.Minute) // Settle the speeds
+
+	rpms, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpms) != 10 {
+		t.Fatalf("got %d RPMs, want 10", len(rpms))
+	}
+	if rpms[2] != 1500 {
+		t.Errorf("fan 2: got %d RPM, want 1500", rpms[2])
+	}
+	if want := uint16(1500 * 51 / 255); rpms[0] != want {
+		t.Errorf("fan 0: got %d RPM, want %d", rpms[0], want)
+	}
+
+	rpm, err := c.RPM(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpm != 1500 {
+		t.Errorf("fan 2: got %d RPM, want 1500", rpm)
+	}
+}
+
+func TestControllerRPM(t *testing.T) {
+	c, clk := emulate(t, emulator.Options{MaxRPM: 2000})
+
+	rpm, err := c.SetRPM(4, 1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpm != 1200 {
+		t.Errorf("applied RPM: got %d, want 1200", rpm)
+	}
+
+	clk.Add(time.Minute)
+
+	rpms, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpms[4] != 1200 {
+		t.Errorf("fan 4: got %d RPM, want 1200", rpms[4])
+	}
+	if rpms[3] != 0 {
+		t.Errorf("fan 3: got %d RPM, want 0", rpms[3])
+	}
+}
+
+func TestControllerInfo(t *testing.T) {
+	// Firmware log lines are interleaved with the multiline responses.
+	c, _ := emulate(t, emulator.Options{Channels: 5, Logs: true})
+
+	hw, err := c.HardwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := openfan.HardwareInfo{
+		Revision:          "emulator",
+		MCU:               "RP2040",
+		USB:               "NATIVE",
+		FanChannelsTotal:  "5",
+		FanChannelsArch:   "5+5",
+		FanChannelsDriver: "EMC2305",
+	}
+	if *hw != want {
+		t.Errorf("hardware info: got %+v, want %+v", *hw, want)
+	}
+
+	n, err := c.Channels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("channels: got %d, want 5", n)
+	}
+
+	fw, err := c.FirmwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.Revision != "emulator" || fw.ProtocolVersion != "1" {
+		t.Errorf("firmware info: got %+v", *fw)
+	}
+}
+
+func TestControllerTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 64)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return // Never answers
+			}
+		}
+	}()
+
+	c, err := openfan.OpenConfig(openfan.DeviceConfig{
+		Port:        "tcp://" + ln.Addr().String(),
+		ReadTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	if _, err = c.RPMs(); !errors.Is(err, openfan.ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, openfan.ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < 125*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("timeout took %s, want the 500ms deadline scaled by the read timeout", elapsed)
+	}
+
+	if !c.Status().Connected {
+		t.Error("a timeout must not be seen as a disconnection")
+	}
+}
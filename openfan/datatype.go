@@ -1,10 +1,14 @@
 package openfan
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 type (
-	Command uint8
-	Fan     uint8
+	Command  uint8
+	Fan      uint8
+	Register uint8
 )
 
 type HardwareInfo struct {
@@ -16,11 +20,33 @@ type HardwareInfo struct {
 	FanChannelsDriver string `json:"fan_channels_driver" cbor:"6,keyasint,omitempty,omitzero"`
 }
 
+// Channels returns the number of fan channels reported by the hardware.
+func (hw HardwareInfo) Channels() (int, error) {
+	n, err := strconv.Atoi(hw.FanChannelsTotal)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid FAN_CHANNELS_TOTAL %q", hw.FanChannelsTotal)
+	}
+
+	return n, nil
+}
+
 type FirmwareInfo struct {
 	Revision        string `json:"revision" cbor:"1,keyasint,omitempty,omitzero"`
 	ProtocolVersion string `json:"protocol_version" cbor:"2,keyasint,omitempty,omitzero"`
 }
 
+// Status is the connection status of a Controller.
+type Status struct {
+	Connected  bool
+	Port       string
+	Reconnects int
+	Err        error
+}
+
+func ToPtr[T any](v T) *T {
+	return &v
+}
+
 func f2x[T ~uint8](v T) (byte, byte) {
 	s := fmt.Sprintf("%02X", v)
 	return s[0], s[1]
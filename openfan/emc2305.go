@@ -0,0 +1,336 @@
+package openfan
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EMC2305 registers (cf. Microchip EMC2301/2/3/5 datasheet).
+// The registers of a fan channel are at FanRegisterBase + ChannelOffset * channel.
+const (
+	EMCRegConfiguration     Register = 0x20
+	EMCRegFanStatus         Register = 0x24
+	EMCRegFanStallStatus    Register = 0x25
+	EMCRegFanSpinStatus     Register = 0x26
+	EMCRegDriveFailStatus   Register = 0x27
+	EMCRegFanInterrupt      Register = 0x29
+	EMCRegPWMPolarity       Register = 0x2A
+	EMCRegPWMOutputConfig   Register = 0x2B
+	EMCRegPWMBaseFrequency2 Register = 0x2C // PWM 4-5
+	EMCRegPWMBaseFrequency1 Register = 0x2D // PWM 1-3
+	EMCRegSoftwareLock      Register = 0xEF
+	EMCRegProductFeatures   Register = 0xFC
+	EMCRegProductID         Register = 0xFD
+	EMCRegManufacturerID    Register = 0xFE
+	EMCRegRevision          Register = 0xFF
+
+	EMCRegFanSetting        Register = 0x30
+	EMCRegPWMDivide         Register = 0x31
+	EMCRegFanConfiguration  Register = 0x32
+	EMCRegFanConfiguration2 Register = 0x33
+	EMCRegGain              Register = 0x35
+	EMCRegSpinUpConfig      Register = 0x36
+	EMCRegFanMaxStep        Register = 0x37
+	EMCRegFanMinimumDrive   Register = 0x38
+	EMCRegValidTachCount    Register = 0x39
+	EMCRegDriveFailBandLow  Register = 0x3A
+	EMCRegDriveFailBandHigh Register = 0x3B
+	EMCRegTachTargetLow     Register = 0x3C
+	EMCRegTachTargetHigh    Register = 0x3D
+	EMCRegTachReadingHigh   Register = 0x3E
+	EMCRegTachReadingLow    Register = 0x3F
+
+	EMCChannelOffset = 0x10
+	EMCChannels      = 5 // Channels per EMC2305
+)
+
+var ErrInvalidFanDriver = errors.New("invalid fan driver setting")
+
+type PWMFrequency uint8
+
+const (
+	PWMFrequency26kHz PWMFrequency = iota
+	PWMFrequency19kHz
+	PWMFrequency4kHz
+	PWMFrequency2kHz
+)
+
+var pwmFrequencies = []string{"26kHz", "19.5kHz", "4.9kHz", "2.4kHz"}
+
+func (f PWMFrequency) String() string {
+	if int(f) < len(pwmFrequencies) {
+		return pwmFrequencies[f]
+	}
+	return fmt.Sprintf("PWMFrequency(%d)", f)
+}
+
+func ParsePWMFrequency(s string) (PWMFrequency, error) {
+	for i, v := range pwmFrequencies {
+		if strings.EqualFold(s, v) {
+			return PWMFrequency(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: pwm frequency %s must be one of %s", ErrInvalidFanDriver, s, strings.Join(pwmFrequencies, ", "))
+}
+
+var (
+	spinUpLevels = []int{30, 35, 40, 45, 50, 55, 60, 65} // %
+	spinUpTimes  = []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second}
+	rpmRanges    = []int{500, 1000, 2000, 4000} // Minimum RPM
+	edges        = []int{3, 5, 7, 9}            // 1, 2, 3 & 4 poles
+)
+
+// A FanDriver holds the settings of a fan channel driven by an EMC2305.
+type FanDriver struct {
+	PWMFrequency PWMFrequency
+	// SpinUpLevel is the drive applied to start the fan in percent (30 to 65 by step of 5).
+	SpinUpLevel int
+	// SpinUpTime is the duration of the spin-up (250ms, 500ms, 1s or 2s).
+	SpinUpTime time.Duration
+	// SpinUpKick disables the 100% drive kick before the spin-up level when false.
+	SpinUpKick bool
+	// RPMRange is the minimum RPM measurable (500, 1000, 2000 or 4000).
+	RPMRange int
+	// Edges is the number of tachometer edges per revolution (3, 5, 7 or 9).
+	Edges int
+	// MinDrive is the minimum drive in raw duty (0-255).
+	MinDrive uint8
+}
+
+func (d FanDriver) Validate() error {
+	if d.PWMFrequency > PWMFrequency2kHz {
+		return fmt.Errorf("%w: pwm frequency %d", ErrInvalidFanDriver, d.PWMFrequency)
+	}
+	if slices.Index(spinUpLevels, d.SpinUpLevel) < 0 {
+		return fmt.Errorf("%w: spin-up level %d%% must be one of %s", ErrInvalidFanDriver, d.SpinUpLevel, join(spinUpLevels, "%"))
+	}
+	if slices.Index(spinUpTimes, d.SpinUpTime) < 0 {
+		return fmt.Errorf("%w: spin-up time %s must be one of %s", ErrInvalidFanDriver, d.SpinUpTime, join(spinUpTimes, ""))
+	}
+	if slices.Index(rpmRanges, d.RPMRange) < 0 {
+		return fmt.Errorf("%w: rpm range %d must be one of %s", ErrInvalidFanDriver, d.RPMRange, join(rpmRanges, ""))
+	}
+	if slices.Index(edges, d.Edges) < 0 {
+		return fmt.Errorf("%w: edges %d must be one of %s", ErrInvalidFanDriver, d.Edges, join(edges, ""))
+	}
+
+	return nil
+}
+
+// emcLocation returns the EMC2305 and its channel driving the given fan.
+// OpenFanController has two EMC2305 (FAN_CHANNELS_ARCH 5+5): fan1-5 on the first one and fan6-10 on the second one.
+func emcLocation(f Fan) (chip uint8, channel uint8) {
+	return uint8(f) / EMCChannels, uint8(f) % EMCChannels
+}
+
+// EMCFanRegister returns the address of a per channel register for the given channel of an EMC2305.
+func EMCFanRegister(reg Register, channel uint8) Register {
+	return reg + Register(channel)*EMCChannelOffset
+}
+
+// ReadRegister reads a register of the given EMC2305.
+func (c *Controller) ReadRegister(chip uint8, reg Register) (uint8, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.readRegister(chip, reg)
+}
+
+// WriteRegister writes a register of the given EMC2305.
+// It is dangerous, a wrong value can stop the fans.
+func (c *Controller) WriteRegister(chip uint8, reg Register, v uint8) error {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.writeRegister(chip, reg, v)
+}
+
+// FanDriver reads the EMC2305 settings of the given fan.
+func (c *Controller) FanDriver(f Fan) (FanDriver, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	var d FanDriver
+	chip, channel := emcLocation(f)
+
+	freq, err := c.readRegister(chip, pwmFrequencyRegister(channel))
+	if err != nil {
+		return d, err
+	}
+	d.PWMFrequency = PWMFrequency(freq >> pwmFrequencyShift(channel) & 0b11)
+
+	config, err := c.readRegister(chip, EMCFanRegister(EMCRegFanConfiguration, channel))
+	if err != nil {
+		return d, err
+	}
+	d.RPMRange = rpmRanges[config>>5&0b11]
+	d.Edges = edges[config>>3&0b11]
+
+	spinup, err := c.readRegister(chip, EMCFanRegister(EMCRegSpinUpConfig, channel))
+	if err != nil {
+		return d, err
+	}
+	d.SpinUpKick = spinup&(1<<5) == 0
+	d.SpinUpLevel = spinUpLevels[spinup>>2&0b111]
+	d.SpinUpTime = spinUpTimes[spinup&0b11]
+
+	d.MinDrive, err = c.readRegister(chip, EMCFanRegister(EMCRegFanMinimumDrive, channel))
+	return d, err
+}
+
+// SetFanDriver writes the EMC2305 settings of the given fan.
+// Bits of the registers that are not part of FanDriver are preserved.
+func (c *Controller) SetFanDriver(f Fan, d FanDriver) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	if err := c.setFanDriver(f, d); err != nil {
+		return err
+	}
+
+	c.drivers[f] = d
+	return nil
+}
+
+// setFanDriver must be called with the lock held.
+func (c *Controller) setFanDriver(f Fan, d FanDriver) error {
+	chip, channel := emcLocation(f)
+
+	err := c.updateRegister(chip, pwmFrequencyRegister(channel), 0b11<<pwmFrequencyShift(channel), uint8(d.PWMFrequency)<<pwmFrequencyShift(channel))
+	if err != nil {
+		return err
+	}
+
+	err = c.updateRegister(chip, EMCFanRegister(EMCRegFanConfiguration, channel), 0b1111<<3, uint8(slices.Index(rpmRanges, d.RPMRange))<<5|uint8(slices.Index(edges, d.Edges))<<3)
+	if err != nil {
+		return err
+	}
+
+	var nokick uint8
+	if !d.SpinUpKick {
+		nokick = 1 << 5
+	}
+	err = c.updateRegister(chip, EMCFanRegister(EMCRegSpinUpConfig, channel), 0b111111, nokick|uint8(slices.Index(spinUpLevels, d.SpinUpLevel))<<2|uint8(slices.Index(spinUpTimes, d.SpinUpTime)))
+	if err != nil {
+		return err
+	}
+
+	return c.writeRegister(chip, EMCFanRegister(EMCRegFanMinimumDrive, channel), d.MinDrive)
+}
+
+// selectRegister must be called with the lock held.
+func (c *Controller) selectRegister(chip uint8, reg Register) error {
+	c1, c2 := f2x(chip)
+	r1, r2 := f2x(reg)
+
+	response, err := c.exec(CommandEMCDebugReg, c1, c2, r1, r2)
+	if err != nil {
+		return fmt.Errorf("emc_debug_reg: %w", err)
+	}
+
+	if want := fmt.Sprintf("%02X:%02X", chip, reg); string(response) != want {
+		return fmt.Errorf("emc_debug_reg: %w: selected %q instead of %s", ErrProtocol, response, want)
+	}
+
+	return nil
+}
+
+// readRegister must be called with the lock held.
+func (c *Controller) readRegister(chip uint8, reg Register) (uint8, error) {
+	if err := c.selectRegister(chip, reg); err != nil {
+		return 0, err
+	}
+
+	response, err := c.exec(CommandEMCDebugRead)
+	if err != nil {
+		return 0, fmt.Errorf("emc_debug_read: %w", err)
+	}
+
+	return parseRegister("emc_debug_read", reg, response)
+}
+
+// writeRegister must be called with the lock held.
+func (c *Controller) writeRegister(chip uint8, reg Register, v uint8) error {
+	if err := c.selectRegister(chip, reg); err != nil {
+		return err
+	}
+
+	v1, v2 := f2x(v)
+	response, err := c.exec(CommandEMCDebugWrite, v1, v2)
+	if err != nil {
+		return fmt.Errorf("emc_debug_write: %w", err)
+	}
+
+	written, err := parseRegister("emc_debug_write", reg, response)
+	if err != nil {
+		return err
+	}
+	if written != v {
+		return fmt.Errorf("emc_debug_write: %w: wrote %02X instead of %02X", ErrProtocol, written, v)
+	}
+
+	return nil
+}
+
+// updateRegister replaces the bits of mask by v.
+// It must be called with the lock held.
+func (c *Controller) updateRegister(chip uint8, reg Register, mask, v uint8) error {
+	current, err := c.readRegister(chip, reg)
+	if err != nil {
+		return err
+	}
+
+	next := current&^mask | v&mask
+	if next == current {
+		return nil
+	}
+
+	return c.writeRegister(chip, reg, next)
+}
+
+// parseRegister parses a `RR:VV` response.
+func parseRegister(name string, reg Register, response []byte) (uint8, error) {
+	r, v, ok := strings.Cut(string(response), ":")
+	if !ok {
+		return 0, fmt.Errorf("%s: invalid response format", name)
+	}
+
+	if rr, err := strconv.ParseUint(r, 16, 8); err != nil || Register(rr) != reg {
+		return 0, fmt.Errorf("%s: %w: register %q instead of %02X", name, ErrProtocol, r, reg)
+	}
+
+	vv, err := strconv.ParseUint(v, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return uint8(vv), nil
+}
+
+func pwmFrequencyRegister(channel uint8) Register {
+	if channel < 3 {
+		return EMCRegPWMBaseFrequency1
+	}
+	return EMCRegPWMBaseFrequency2
+}
+
+func pwmFrequencyShift(channel uint8) uint8 {
+	return channel % 3 * 2
+}
+
+func join[T any](values []T, unit string) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprint(v) + unit
+	}
+	return strings.Join(s, ", ")
+}
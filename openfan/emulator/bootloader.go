@@ -0,0 +1,70 @@
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan/firmware"
+)
+
+// MountBootloader emulates the mass-storage drive of the RP2040 bootloader under root.
+// Once a valid UF2 image is copied on the drive, the drive is removed and the emulator runs the new firmware.
+// The new firmware revision is the name of the image without its extension.
+func (e *Emulator) MountBootloader(ctx context.Context, root string) (string, error) {
+	mount := filepath.Join(root, firmware.BootloaderVolume)
+	if err := os.MkdirAll(mount, 0o755); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(mount)
+
+	err := os.WriteFile(filepath.Join(mount, firmware.InfoFile), []byte(firmware.BootloaderInfo), 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	sizes := map[string]int64{} // An image is read once its size is stable, i.e. fully copied
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+
+		matches, _ := filepath.Glob(filepath.Join(mount, "*.uf2"))
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if size, ok := sizes[match]; !ok || size != fi.Size() {
+				sizes[match] = fi.Size()
+				continue
+			}
+
+			image, err := os.ReadFile(match)
+			if err != nil {
+				return "", err
+			}
+
+			if err = firmware.ValidateUF2(image); err != nil {
+				// Like the bootrom, ignore the garbage and keep waiting.
+				fmt.Println("Ignoring", filepath.Base(match), err)
+				os.Remove(match)
+				delete(sizes, match)
+				continue
+			}
+
+			revision := strings.TrimSuffix(filepath.Base(match), filepath.Ext(match))
+			e.Flash(revision)
+			return revision, nil
+		}
+	}
+}
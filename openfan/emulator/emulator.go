@@ -0,0 +1,315 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+)
+
+const DefaultInertia = 1500 * time.Millisecond
+
+// An Emulator speaks the ASCII protocol of the OpenFanController firmware.
+// It should only be used for dev & tests.
+type Emulator struct {
+	sync     sync.Mutex
+	opts     Options
+	fans     []fan
+	emc      [2][256]byte // Two EMC2305 of 5 channels each
+	chip     uint8
+	register uint8
+	jumped   bool
+	// bootloader is true while the device is in the bootloader, it does not answer the requests.
+	bootloader bool
+}
+
+type Options struct {
+	// Channels is the number of fans (default 10).
+	Channels int
+	// MaxRPM is the speed of a fan at 100% (default 1500).
+	MaxRPM float64
+	// Inertia is the time constant of the fans' speed changes (default 1.5s).
+	Inertia time.Duration
+	// Logs makes the emulator send firmware log lines along with the responses.
+	Logs bool
+	// Now is the clock of the emulator (default time.Now).
+	Now func() time.Time
+	// OnBootloader is called once CommandJumpToBootLoader has been answered.
+	OnBootloader func()
+
+	HardwareInfo openfan.HardwareInfo
+	FirmwareInfo openfan.FirmwareInfo
+}
+
+type fan struct {
+	pwm       uint8
+	targetRPM float64 // Closed-loop target, zero means PWM driven
+	rpm       float64
+	updatedAt time.Time
+}
+
+func New(opts Options) *Emulator {
+	if opts.Channels == 0 {
+		opts.Channels = 10
+	}
+	if opts.MaxRPM == 0 {
+		opts.MaxRPM = 1500
+	}
+	if opts.Inertia == 0 {
+		opts.Inertia = DefaultInertia
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.HardwareInfo == (openfan.HardwareInfo{}) {
+		opts.HardwareInfo = openfan.HardwareInfo{
+			Revision:          "emulator",
+			MCU:               "RP2040",
+			USB:               "NATIVE",
+			FanChannelsTotal:  strconv.Itoa(opts.Channels),
+			FanChannelsArch:   "5+5",
+			FanChannelsDriver: "EMC2305",
+		}
+	}
+	if opts.FirmwareInfo == (openfan.FirmwareInfo{}) {
+		opts.FirmwareInfo = openfan.FirmwareInfo{
+			Revision:        "emulator",
+			ProtocolVersion: "1",
+		}
+	}
+
+	e := &Emulator{
+		opts: opts,
+		fans: make([]fan, opts.Channels),
+	}
+
+	now := opts.Now()
+	for i := range e.fans {
+		e.fans[i].updatedAt = now
+	}
+
+	// Power-on defaults of the EMC2305 registers.
+	for chip := range e.emc {
+		e.emc[chip][openfan.EMCRegProductID] = 0x34
+		e.emc[chip][openfan.EMCRegManufacturerID] = 0x5D
+		e.emc[chip][openfan.EMCRegRevision] = 0x80
+		for channel := range uint8(openfan.EMCChannels) {
+			e.emc[chip][openfan.EMCFanRegister(openfan.EMCRegFanConfiguration, channel)] = 0x2B
+			e.emc[chip][openfan.EMCFanRegister(openfan.EMCRegSpinUpConfig, channel)] = 0x19
+			e.emc[chip][openfan.EMCFanRegister(openfan.EMCRegFanMinimumDrive, channel)] = 0x66
+			e.emc[chip][openfan.EMCFanRegister(openfan.EMCRegValidTachCount, channel)] = 0xF5
+		}
+	}
+
+	return e
+}
+
+// Serve handles the requests read from rw until an error occurs.
+func (e *Emulator) Serve(rw io.ReadWriter) error {
+	r := bufio.NewReader(rw)
+	for {
+		line, err := r.ReadBytes(openfan.CommEndCharacter)
+		if err != nil {
+			return err
+		}
+
+		response := e.Handle(line)
+		if len(response) == 0 {
+			continue
+		}
+
+		if _, err = rw.Write(response); err != nil {
+			return err
+		}
+
+		e.sync.Lock()
+		jumped := e.jumped
+		e.jumped = false
+		e.sync.Unlock()
+
+		if jumped && e.opts.OnBootloader != nil {
+			e.opts.OnBootloader()
+		}
+	}
+}
+
+// Handle returns the bytes sent by the firmware for the given request line.
+func (e *Emulator) Handle(request []byte) []byte {
+	e.sync.Lock()
+	defer e.sync.Unlock()
+
+	if e.bootloader {
+		return nil
+	}
+
+	request = bytes.TrimSpace(request)
+	if len(request) < openfan.CommMinMessageLength || request[0] != openfan.CommRequestCharacter {
+		return e.log("Invalid request")
+	}
+
+	code, err := strconv.ParseUint(string(request[1:3]), 16, 8)
+	if err != nil {
+		return e.log("Invalid command")
+	}
+	command := openfan.Command(code)
+	payload := string(request[3:])
+
+	var response string
+	switch command {
+	case openfan.CommandFanAllGetRPM:
+		var b strings.Builder
+		for i := range e.fans {
+			fmt.Fprintf(&b, "%02X:%04X;", i, e.rpm(i))
+		}
+		response = b.String()
+	case openfan.CommandFanGetRPM:
+		f, ok := e.fan(payload)
+		if !ok {
+			return e.log("Invalid fan")
+		}
+		response = fmt.Sprintf("%02X:%04X", f, e.rpm(f))
+	case openfan.CommandFanSetPWM:
+		f, ok := e.fan(payload)
+		if !ok || len(payload) != 4 {
+			return e.log("Invalid fan")
+		}
+		pwm, err := strconv.ParseUint(payload[2:4], 16, 8)
+		if err != nil {
+			return e.log("Invalid PWM")
+		}
+		e.setPWM(f, uint8(pwm))
+		response = fmt.Sprintf("%02X:%02X", f, pwm)
+	case openfan.CommandFanSetAllPWM:
+		pwm, err := strconv.ParseUint(payload, 16, 8)
+		if err != nil {
+			return e.log("Invalid PWM")
+		}
+		for i := range e.fans {
+			e.setPWM(i, uint8(pwm))
+		}
+		response = fmt.Sprintf("%02X", pwm)
+	case openfan.CommandFanSetRPM:
+		f, ok := e.fan(payload)
+		if !ok || len(payload) != 6 {
+			return e.log("Invalid fan")
+		}
+		rpm, err := strconv.ParseUint(payload[2:6], 16, 16)
+		if err != nil {
+			return e.log("Invalid RPM")
+		}
+		e.rpm(f) // Settle the current speed before changing the target
+		e.fans[f].targetRPM = min(float64(rpm), e.opts.MaxRPM)
+		response = fmt.Sprintf("%02X:%04X", f, rpm)
+	case openfan.CommandHardwareInfo:
+		hw := e.opts.HardwareInfo
+		response = strings.Join([]string{
+			"HW_REV:" + hw.Revision,
+			"MCU:" + hw.MCU,
+			"USB:" + hw.USB,
+			"FAN_CHANNELS_TOTAL:" + hw.FanChannelsTotal,
+			"FAN_CHANNELS_ARCH:" + hw.FanChannelsArch,
+			"FAN_CHANNELS_DRIVER:" + hw.FanChannelsDriver,
+		}, "\r\n")
+	case openfan.CommandFirmwareInfo:
+		fw := e.opts.FirmwareInfo
+		response = strings.Join([]string{
+			"FW_REV:" + fw.Revision,
+			"PROTOCOL_VERSION:" + fw.ProtocolVersion,
+		}, "\r\n")
+	case openfan.CommandJumpToBootLoader:
+		e.jumped = true
+		e.bootloader = true
+		response = "OK"
+	case openfan.CommandEMCDebugReg:
+		if len(payload) != 4 {
+			return e.log("Invalid register")
+		}
+		chip, err1 := strconv.ParseUint(payload[:2], 16, 8)
+		register, err2 := strconv.ParseUint(payload[2:], 16, 8)
+		if err1 != nil || err2 != nil || int(chip) >= len(e.emc) {
+			return e.log("Invalid register")
+		}
+		e.chip, e.register = uint8(chip), uint8(register)
+		response = fmt.Sprintf("%02X:%02X", e.chip, e.register)
+	case openfan.CommandEMCDebugRead:
+		response = fmt.Sprintf("%02X:%02X", e.register, e.emc[e.chip][e.register])
+	case openfan.CommandEMCDebugWrite:
+		v, err := strconv.ParseUint(payload, 16, 8)
+		if err != nil {
+			return e.log("Invalid value")
+		}
+		e.emc[e.chip][e.register] = uint8(v)
+		response = fmt.Sprintf("%02X:%02X", e.register, v)
+	default:
+		return e.log("Unknown command")
+	}
+
+	var b []byte
+	if e.opts.Logs {
+		b = e.log(fmt.Sprintf("Received command %02X", command))
+	}
+	b = fmt.Appendf(b, "%c%02X|%s\r\n", openfan.CommResponseCharacter, command, response)
+	return b
+}
+
+// Flash leaves the bootloader and runs the given firmware revision.
+func (e *Emulator) Flash(revision string) {
+	e.sync.Lock()
+	defer e.sync.Unlock()
+
+	e.bootloader = false
+	e.opts.FirmwareInfo.Revision = revision
+
+	now := e.opts.Now()
+	for i := range e.fans {
+		e.fans[i] = fan{updatedAt: now} // Rebooted
+	}
+}
+
+// fan parses the fan index at the beginning of the payload.
+func (e *Emulator) fan(payload string) (int, bool) {
+	if len(payload) < 2 {
+		return 0, false
+	}
+
+	f, err := strconv.ParseUint(payload[:2], 16, 8)
+	if err != nil || int(f) >= len(e.fans) {
+		return 0, false
+	}
+
+	return int(f), true
+}
+
+func (e *Emulator) setPWM(f int, pwm uint8) {
+	e.rpm(f) // Settle the current speed before changing the target
+	e.fans[f].pwm = pwm
+	e.fans[f].targetRPM = 0
+}
+
+// rpm returns the current speed of the given fan, approaching its target with a first-order inertia.
+func (e *Emulator) rpm(f int) uint16 {
+	fan := &e.fans[f]
+
+	target := fan.targetRPM
+	if target == 0 {
+		target = e.opts.MaxRPM * float64(fan.pwm) / 255
+	}
+
+	now := e.opts.Now()
+	dt := now.Sub(fan.updatedAt)
+	fan.updatedAt = now
+	fan.rpm = target + (fan.rpm-target)*math.Exp(-float64(dt)/float64(e.opts.Inertia))
+
+	return uint16(math.Round(fan.rpm))
+}
+
+func (e *Emulator) log(msg string) []byte {
+	return fmt.Appendf(nil, "DBG: %s\r\n", msg)
+}
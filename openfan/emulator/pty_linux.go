@@ -0,0 +1,113 @@
+package emulator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// A PTY is a pseudo-terminal which slave side can be opened as an OpenFan serial port.
+type PTY struct {
+	master *os.File
+	slave  *os.File
+	name   string
+}
+
+// OpenPTY opens a new pseudo-terminal in raw mode.
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ptmx: %w", err)
+	}
+
+	var n int
+	err = control(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return fmt.Errorf("unlockpt: %w", err)
+		}
+
+		n, err = unix.IoctlGetInt(fd, unix.TIOCGPTN)
+		if err != nil {
+			return fmt.Errorf("ptsname: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", n)
+
+	// Keep the slave side opened so the master side does not fail with EIO while no client is connected.
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("pts: %w", err)
+	}
+
+	err = control(slave, func(fd int) error {
+		termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err != nil {
+			return err
+		}
+
+		// cfmakeraw(3)
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		termios.Cflag &^= unix.CSIZE | unix.PARENB
+		termios.Cflag |= unix.CS8
+
+		return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	})
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("raw mode: %w", err)
+	}
+
+	return &PTY{
+		master: master,
+		slave:  slave,
+		name:   name,
+	}, nil
+}
+
+// Name returns the path of the slave side (e.g. /dev/pts/4).
+func (p *PTY) Name() string {
+	return p.name
+}
+
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.master.Read(b)
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.master.Write(b)
+}
+
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
+
+// control runs fn on the file descriptor without switching the file to blocking mode, so Close can interrupt Read.
+func control(f *os.File, fn func(fd int) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+	err = rc.Control(func(fd uintptr) {
+		ferr = fn(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+
+	return ferr
+}
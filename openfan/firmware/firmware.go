@@ -0,0 +1,137 @@
+package firmware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// BootloaderVolume is the label of the mass-storage drive exposed by the RP2040 bootloader.
+	BootloaderVolume = "RPI-RP2"
+	// InfoFile is the file describing the bootloader at the root of its drive.
+	InfoFile = "INFO_UF2.TXT"
+	// BootloaderInfo is the content of the InfoFile written by the RP2040 bootloader.
+	BootloaderInfo = "UF2 Bootloader v3.0\nModel: Raspberry Pi RP2\nBoard-ID: RPI-RP2\n"
+
+	FamilyRP2040 uint32 = 0xE48BFF56
+)
+
+var ErrInvalidUF2 = errors.New("invalid UF2 image")
+
+// UF2 block layout (cf. https://github.com/microsoft/uf2).
+const (
+	uf2BlockSize   = 512
+	uf2MagicStart0 = 0x0A324655
+	uf2MagicStart1 = 0x9E5D5157
+	uf2MagicEnd    = 0x0AB16F30
+	uf2FlagFamily  = 0x00002000
+)
+
+// ValidateUF2 checks that p is a complete UF2 image for the RP2040.
+func ValidateUF2(p []byte) error {
+	if len(p) == 0 || len(p)%uf2BlockSize != 0 {
+		return fmt.Errorf("%w: size %d is not a multiple of %d", ErrInvalidUF2, len(p), uf2BlockSize)
+	}
+
+	blocks := uint32(len(p) / uf2BlockSize)
+	for i := range blocks {
+		block := p[i*uf2BlockSize : (i+1)*uf2BlockSize]
+		word := func(offset int) uint32 {
+			return binary.LittleEndian.Uint32(block[offset:])
+		}
+
+		if word(0) != uf2MagicStart0 || word(4) != uf2MagicStart1 || word(uf2BlockSize-4) != uf2MagicEnd {
+			return fmt.Errorf("%w: bad magic in block %d", ErrInvalidUF2, i)
+		}
+		if word(20) != i || word(24) != blocks {
+			return fmt.Errorf("%w: block %d is numbered %d/%d", ErrInvalidUF2, i, word(20), word(24))
+		}
+		if word(8)&uf2FlagFamily != 0 && word(28) != FamilyRP2040 {
+			return fmt.Errorf("%w: family %08X is not RP2040", ErrInvalidUF2, word(28))
+		}
+	}
+
+	return nil
+}
+
+// FindBootloader returns the mount point of the RP2040 bootloader drive under root.
+// The drive is looked up at root/RPI-RP2 and root/*/RPI-RP2 (e.g. /media/<user>/RPI-RP2).
+func FindBootloader(root string) (string, bool) {
+	for _, pattern := range []string{
+		filepath.Join(root, BootloaderVolume, InfoFile),
+		filepath.Join(root, "*", BootloaderVolume, InfoFile),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			if isBootloaderInfo(match) {
+				return filepath.Dir(match), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// WaitBootloader waits for the RP2040 bootloader drive to be mounted under root.
+func WaitBootloader(ctx context.Context, root string) (string, error) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if mount, ok := FindBootloader(root); ok {
+			return mount, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("bootloader drive %s not found under %s: %w", BootloaderVolume, root, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Install copies the UF2 image on the bootloader drive.
+// The RP2040 reboots on the new firmware once the image has been fully written.
+func Install(mount, name string, image []byte) error {
+	f, err := os.OpenFile(filepath.Join(mount, filepath.Base(name)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("install: %w", err)
+	}
+
+	if _, err = f.Write(image); err != nil {
+		f.Close()
+		return fmt.Errorf("install: %w", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("install: %w", err)
+	}
+
+	return f.Close()
+}
+
+func isBootloaderInfo(path string) bool {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(p))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if ok && key == "Board-ID" && strings.HasPrefix(strings.TrimSpace(value), BootloaderVolume) {
+			return true
+		}
+	}
+
+	return false
+}
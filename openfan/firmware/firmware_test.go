@@ -0,0 +1,153 @@
+package firmware_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan/emulator"
+	"github.com/mdouchement/openfand/openfan/firmware"
+)
+
+// uf2 returns an image of n blocks for the given family.
+func uf2(n int, family uint32) []byte {
+	p := make([]byte, n*512)
+	for i := range n {
+		block := p[i*512 : (i+1)*512]
+		binary.LittleEndian.PutUint32(block[0:], 0x0A324655)
+		binary.LittleEndian.PutUint32(block[4:], 0x9E5D5157)
+		binary.LittleEndian.PutUint32(block[8:], 0x00002000) // Family flag
+		binary.LittleEndian.PutUint32(block[20:], uint32(i))
+		binary.LittleEndian.PutUint32(block[24:], uint32(n))
+		binary.LittleEndian.PutUint32(block[28:], family)
+		binary.LittleEndian.PutUint32(block[508:], 0x0AB16F30)
+	}
+	return p
+}
+
+func TestValidateUF2(t *testing.T) {
+	truncated := uf2(2, firmware.FamilyRP2040)[:700]
+	badMagic := uf2(2, firmware.FamilyRP2040)
+	badMagic[512+508] = 0
+	misnumbered := uf2(2, firmware.FamilyRP2040)
+	binary.LittleEndian.PutUint32(misnumbered[512+20:], 0)
+
+	for name, tc := range map[string]struct {
+		image []byte
+		valid bool
+	}{
+		"valid":        {image: uf2(3, firmware.FamilyRP2040), valid: true},
+		"empty":        {image: nil},
+		"truncated":    {image: truncated},
+		"bad magic":    {image: badMagic},
+		"misnumbered":  {image: misnumbered},
+		"other family": {image: uf2(1, 0x57755A57)}, // RP2350
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := firmware.ValidateUF2(tc.image)
+			if tc.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.valid && !errors.Is(err, firmware.ErrInvalidUF2) {
+				t.Errorf("got %v, want %v", err, firmware.ErrInvalidUF2)
+			}
+		})
+	}
+}
+
+func TestFindBootloader(t *testing.T) {
+	root := t.TempDir()
+
+	if _, ok := firmware.FindBootloader(root); ok {
+		t.Fatal("no bootloader drive should be found")
+	}
+
+	// A drive with the same label but another board is ignored.
+	other := filepath.Join(root, "alice", firmware.BootloaderVolume)
+	if err := os.MkdirAll(other, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(other, firmware.InfoFile), []byte("Board-ID: OTHER\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := firmware.FindBootloader(root); ok {
+		t.Fatal("the drive of another board should be ignored")
+	}
+
+	// Mounted as /media/<user>/RPI-RP2.
+	mount := filepath.Join(root, "bob", firmware.BootloaderVolume)
+	if err := os.MkdirAll(mount, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mount, firmware.InfoFile), []byte(firmware.BootloaderInfo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, ok := firmware.FindBootloader(root)
+	if !ok || found != mount {
+		t.Errorf("got %q, %v, want %q", found, ok, mount)
+	}
+}
+
+func TestWaitBootloaderTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if _, err := firmware.WaitBootloader(ctx, t.TempDir()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	root := t.TempDir()
+	e := emulator.New(emulator.Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	flashed := make(chan string, 1)
+	go func() {
+		revision, err := e.MountBootloader(ctx, root)
+		if err != nil {
+			t.Error(err)
+		}
+		flashed <- revision
+	}()
+
+	mount, err := firmware.WaitBootloader(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bad image is ignored by the bootloader, which keeps waiting.
+	if err = firmware.Install(mount, "garbage.uf2", uf2(2, 0x57755A57)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	select {
+	case revision := <-flashed:
+		t.Fatalf("flashed %q with a bad image", revision)
+	default:
+	}
+
+	if err = firmware.Install(mount, "/tmp/v1.2.3.uf2", uf2(4, firmware.FamilyRP2040)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case revision := <-flashed:
+		if revision != "v1.2.3" {
+			t.Errorf("revision: got %q, want v1.2.3", revision)
+		}
+	case <-ctx.Done():
+		t.Fatal("the image was not flashed")
+	}
+
+	if _, ok := firmware.FindBootloader(root); ok {
+		t.Error("the bootloader drive should be gone once flashed")
+	}
+}
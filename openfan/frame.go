@@ -0,0 +1,198 @@
+package openfan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrTimeout           = errors.New("response timeout")
+	ErrProtocol          = errors.New("protocol error")
+	ErrUnexpectedCommand = errors.New("unexpected command")
+)
+
+const (
+	// defaultDeadline is the maximum duration to receive a response with the DefaultReadTimeout.
+	defaultDeadline = 500 * time.Millisecond
+	// multilineQuiet is the silence that ends a multiline response.
+	// The firmware sends the whole response at once so it only has to cover USB scheduling.
+	multilineQuiet = 50 * time.Millisecond
+	readPolling    = 200 * time.Millisecond
+)
+
+// deadlines are the maximum durations to receive the response of a command with the DefaultReadTimeout.
+var deadlines = map[Command]time.Duration{
+	CommandHardwareInfo: time.Second,
+	CommandFirmwareInfo: time.Second,
+}
+
+// multilines are the commands which response spans several lines:
+//
+//	<05|HW_REV:01
+//	MCU:RP2040
+//	...
+var multilines = map[Command]bool{
+	CommandHardwareInfo: true,
+	CommandFirmwareInfo: true,
+}
+
+var reContinuation = regexp.MustCompile(`^[A-Z0-9_]+:`)
+
+// deadline returns the maximum duration to receive the response of the command,
+// scaled by the configured read timeout so slow links (e.g. rfc2217) can be given more time.
+func (c Command) deadline(readTimeout time.Duration) time.Duration {
+	d, ok := deadlines[c]
+	if !ok {
+		d = defaultDeadline
+	}
+	return time.Duration(float64(d) * float64(readTimeout) / float64(DefaultReadTimeout))
+}
+
+type lineReader interface {
+	Read(p []byte) (int, error)
+	SetReadTimeout(t time.Duration) error
+}
+
+// A decoder splits the bytes received from the device into lines.
+type decoder struct {
+	r    lineReader
+	buf  []byte
+	rbuf []byte
+	// polling is the maximum duration of a read.
+	polling time.Duration
+}
+
+func newDecoder(r lineReader) *decoder {
+	return &decoder{
+		r:    r,
+		buf:  make([]byte, 0, CommRxBufferLenASCII*32), // aka 4096 which is plenty (512 is enough)
+		rbuf: make([]byte, CommRxBufferLenASCII),
+
+		polling: readPolling,
+	}
+}
+
+// reset discards the pending bytes.
+func (d *decoder) reset() {
+	d.buf = d.buf[:0]
+}
+
+// readLine returns the next line without its line ending.
+// The returned slice is only valid until the next call.
+func (d *decoder) readLine(deadline time.Time) ([]byte, error) {
+	for {
+		if i := bytes.IndexByte(d.buf, CommEndCharacter); i >= 0 {
+			line := bytes.TrimRight(d.buf[:i], string(CommAltEndCharacter))
+			line = append([]byte(nil), line...)
+			d.buf = d.buf[:copy(d.buf, d.buf[i+1:])]
+			return line, nil
+		}
+
+		if len(d.buf) >= cap(d.buf) {
+			d.reset()
+			return nil, fmt.Errorf("%w: line too long", ErrProtocol)
+		}
+
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return nil, ErrTimeout
+		}
+
+		if err := d.r.SetReadTimeout(min(timeout, d.polling)); err != nil {
+			return nil, err
+		}
+
+		n, err := d.r.Read(d.rbuf[:min(len(d.rbuf), cap(d.buf)-len(d.buf))])
+		if err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+
+		d.buf = append(d.buf, d.rbuf[:n]...)
+	}
+}
+
+// parseResponse parses a response line `<XX|payload`.
+func parseResponse(line []byte) (Command, []byte, error) {
+	if len(line) < 4 || line[0] != CommResponseCharacter || line[3] != '|' {
+		return 0, nil, fmt.Errorf("%w: malformed response %q", ErrProtocol, line)
+	}
+
+	code, err := strconv.ParseUint(string(line[1:3]), 16, 8)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: malformed command %q", ErrProtocol, line[1:3])
+	}
+
+	return Command(code), line[4:], nil
+}
+
+// readResponse reads the response of the given command.
+// Firmware log lines received meanwhile are forwarded to the logger.
+func (c *Controller) readResponse(command Command) ([]byte, error) {
+	deadline := time.Now().Add(command.deadline(c.readTimeout))
+
+	var response []byte
+	for {
+		line, err := c.dec.readLine(deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != CommResponseCharacter {
+			c.debug("firmware", line)
+			continue
+		}
+
+		c.debug("response", line)
+
+		code, payload, err := parseResponse(line)
+		if err != nil {
+			return nil, err
+		}
+		if code != command {
+			return nil, fmt.Errorf("%w: got %02X instead of %02X", ErrUnexpectedCommand, code, command)
+		}
+
+		response = payload
+		break
+	}
+
+	if multilines[command] {
+		for {
+			quiet := time.Now().Add(multilineQuiet)
+			if quiet.After(deadline) {
+				quiet = deadline
+			}
+
+			line, err := c.dec.readLine(quiet)
+			if errors.Is(err, ErrTimeout) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if !reContinuation.Match(line) {
+				c.debug("firmware", line)
+				continue
+			}
+
+			c.debug("response", line)
+			response = append(response, CommAltEndCharacter, CommEndCharacter)
+			response = append(response, line...)
+		}
+	}
+
+	return bytes.TrimSpace(response), nil
+}
+
+func (c *Controller) debug(kind string, line []byte) {
+	if c.log == nil || len(line) == 0 {
+		return
+	}
+
+	c.log.Debugf("%s: %s", kind, line)
+}
@@ -0,0 +1,100 @@
+package openfan
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A script is a lineReader returning one chunk per read, nothing until the timeout once exhausted.
+type script struct {
+	chunks  []string
+	timeout time.Duration
+}
+
+func (s *script) Read(p []byte) (int, error) {
+	if len(s.chunks) == 0 {
+		time.Sleep(s.timeout)
+		return 0, nil
+	}
+
+	n := copy(p, s.chunks[0])
+	s.chunks[0] = s.chunks[0][n:]
+	if s.chunks[0] == "" {
+		s.chunks = s.chunks[1:]
+	}
+	return n, nil
+}
+
+func (s *script) SetReadTimeout(t time.Duration) error {
+	s.timeout = t
+	return nil
+}
+
+func TestReadResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		command Command
+		chunks  []string
+		want    string
+		err     error
+	}{
+		"response": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<00|00:04B0;01:0000;\r\n"},
+			want:    "00:04B0;01:0000;",
+		},
+		"split response": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<", "00|00:0", "4B0;\r", "\n"},
+			want:    "00:04B0;",
+		},
+		"firmware logs": {
+			command: CommandFanSetPWM,
+			chunks:  []string{"\r\nFan 2 set to 50%\r", "\n<02|02:7F;\r\n"},
+			want:    "02:7F;",
+		},
+		"multiline response": {
+			command: CommandHardwareInfo,
+			chunks:  []string{"<05|HW_REV:01\r\nMCU:RP2040\r\n", "boot done\r\n", "USB:NATIVE\r\n"},
+			want:    "HW_REV:01\r\nMCU:RP2040\r\nUSB:NATIVE",
+		},
+		"unexpected command": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<02|02:7F;\r\n"},
+			err:     ErrUnexpectedCommand,
+		},
+		"malformed response": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<00:04B0;\r\n"},
+			err:     ErrProtocol,
+		},
+		"malformed command": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<0G|00:04B0;\r\n"},
+			err:     ErrProtocol,
+		},
+		"line too long": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<00|" + strings.Repeat("0", CommRxBufferLenASCII*32)},
+			err:     ErrProtocol,
+		},
+		"timeout": {
+			command: CommandFanAllGetRPM,
+			chunks:  []string{"<00|00:04B0;"}, // Incomplete
+			err:     ErrTimeout,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := &Controller{dec: newDecoder(&script{chunks: tc.chunks}), readTimeout: 20 * time.Millisecond}
+
+			got, err := c.readResponse(tc.command)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package openfan
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+const (
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// SetStatusHandler registers fn to be notified of disconnections and reconnections.
+// fn is called while the Controller is locked so it must not block nor call the Controller.
+func (c *Controller) SetStatusHandler(fn func(Status)) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.onStatus = fn
+}
+
+func (c *Controller) Status() Status {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.status
+}
+
+// isDisconnection returns true when err means that the device has been unplugged or re-enumerated,
+// or that the connection to its serial server has been lost.
+func isDisconnection(err error) bool {
+	var perr *serial.PortError
+	if errors.As(err, &perr) {
+		return perr.Code() == serial.PortClosed || perr.Code() == serial.PortNotFound
+	}
+
+	return errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.EBADF) ||
+		// Network transports
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT)
+}
+
+// disconnect closes the serial port and starts the reconnection process.
+// It must be called with the lock held.
+func (c *Controller) disconnect(cause error) {
+	if c.transport == nil {
+		return
+	}
+
+	c.transport.Close()
+	c.setTransport(nil)
+
+	c.status.Connected = false
+	c.status.Err = cause
+	c.notify(c.status)
+
+	if c.log != nil {
+		c.log.WithError(cause).Warnf("OpenFan on %s disconnected", c.pname)
+	}
+
+	if c.dial != nil {
+		go c.reconnect()
+	}
+}
+
+func (c *Controller) reconnect() {
+	backoff := reconnectMinBackoff
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		err := c.reopen()
+		if err == nil {
+			return
+		}
+
+		c.sync.Lock()
+		c.status.Err = err
+		c.notify(c.status)
+		c.sync.Unlock()
+
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (c *Controller) reopen() error {
+	port, t, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	select {
+	case <-c.done:
+		// Closed while reopening.
+		return t.Close()
+	default:
+	}
+
+	c.setTransport(t)
+	c.pname = port
+
+	// The board may have been power-cycled, push again the fan driver settings.
+	for _, f := range slices.Sorted(maps.Keys(c.drivers)) {
+		if err = c.setFanDriver(f, c.drivers[f]); err != nil {
+			c.setTransport(nil)
+			t.Close()
+			return fmt.Errorf("restore fan driver: %w", err)
+		}
+	}
+
+	// Push again the last known PWMs and RPMs.
+	if c.pwmAll != nil {
+		pwm1, pwm2 := f2x(*c.pwmAll)
+		if _, err = c.run(CommandFanSetAllPWM, pwm1, pwm2); err != nil {
+			c.setTransport(nil)
+			t.Close()
+			return fmt.Errorf("restore pwm: %w", err)
+		}
+	}
+	for _, f := range slices.Sorted(maps.Keys(c.pwms)) {
+		f1, f2 := f2x(f)
+		pwm1, pwm2 := f2x(c.pwms[f])
+		if _, err = c.run(CommandFanSetPWM, f1, f2, pwm1, pwm2); err != nil {
+			c.setTransport(nil)
+			t.Close()
+			return fmt.Errorf("restore pwm: %w", err)
+		}
+	}
+
+	for _, f := range slices.Sorted(maps.Keys(c.rpms)) {
+		f1, f2 := f2x(f)
+		rpm1, rpm2, rpm3, rpm4 := f4x(c.rpms[f])
+		if _, err = c.run(CommandFanSetRPM, f1, f2, rpm1, rpm2, rpm3, rpm4); err != nil {
+			c.setTransport(nil)
+			t.Close()
+			return fmt.Errorf("restore rpm: %w", err)
+		}
+	}
+
+	c.status = Status{
+		Connected:  true,
+		Port:       port,
+		Reconnects: c.status.Reconnects + 1,
+	}
+	c.notify(c.status)
+
+	if c.log != nil {
+		c.log.Infof("OpenFan reconnected on %s", port)
+	}
+
+	return nil
+}
+
+// notify must be called with the lock held.
+func (c *Controller) notify(s Status) {
+	if c.onStatus != nil {
+		c.onStatus(s)
+	}
+}
@@ -0,0 +1,77 @@
+package openfan_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/openfan/emulator"
+)
+
+func TestReconnectRestoresFanDriver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+
+			go func() {
+				defer conn.Close()
+				emulator.New(emulator.Options{}).Serve(conn) // A power-cycled board on each connection
+			}()
+		}
+	}()
+
+	c, err := openfan.OpenConfig(openfan.DeviceConfig{
+		Port:        "tcp://" + ln.Addr().String(),
+		ReadTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	d, err := c.FanDriver(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.PWMFrequency = openfan.PWMFrequency2kHz
+	d.SpinUpLevel = 45
+	d.SpinUpKick = false
+	d.MinDrive = 0x20
+	if err = c.SetFanDriver(1, d); err != nil {
+		t.Fatal(err)
+	}
+
+	// Power-cycle the board.
+	(<-conns).Close()
+	if _, err = c.RPMs(); err == nil {
+		t.Fatal("expected an error after the disconnection")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.Status().Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("not reconnected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	got, err := c.FanDriver(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != d {
+		t.Errorf("fan driver: got %+v, want %+v", got, d)
+	}
+}
@@ -0,0 +1,181 @@
+package openfan
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var emcRegisterNames = map[Register]string{
+	EMCRegConfiguration:     "CONFIGURATION",
+	EMCRegFanStatus:         "FAN_STATUS",
+	EMCRegFanStallStatus:    "FAN_STALL_STATUS",
+	EMCRegFanSpinStatus:     "FAN_SPIN_STATUS",
+	EMCRegDriveFailStatus:   "DRIVE_FAIL_STATUS",
+	EMCRegFanInterrupt:      "FAN_INTERRUPT_ENABLE",
+	EMCRegPWMPolarity:       "PWM_POLARITY_CONFIG",
+	EMCRegPWMOutputConfig:   "PWM_OUTPUT_CONFIG",
+	EMCRegPWMBaseFrequency2: "PWM_BASE_FREQUENCY_2",
+	EMCRegPWMBaseFrequency1: "PWM_BASE_FREQUENCY_1",
+	EMCRegSoftwareLock:      "SOFTWARE_LOCK",
+	EMCRegProductFeatures:   "PRODUCT_FEATURES",
+	EMCRegProductID:         "PRODUCT_ID",
+	EMCRegManufacturerID:    "MANUFACTURER_ID",
+	EMCRegRevision:          "REVISION",
+}
+
+var emcFanRegisterNames = map[Register]string{
+	EMCRegFanSetting:        "SETTING",
+	EMCRegPWMDivide:         "PWM_DIVIDE",
+	EMCRegFanConfiguration:  "CONFIGURATION_1",
+	EMCRegFanConfiguration2: "CONFIGURATION_2",
+	EMCRegGain:              "GAIN",
+	EMCRegSpinUpConfig:      "SPIN_UP_CONFIG",
+	EMCRegFanMaxStep:        "MAX_STEP",
+	EMCRegFanMinimumDrive:   "MINIMUM_DRIVE",
+	EMCRegValidTachCount:    "VALID_TACH_COUNT",
+	EMCRegDriveFailBandLow:  "DRIVE_FAIL_BAND_LOW",
+	EMCRegDriveFailBandHigh: "DRIVE_FAIL_BAND_HIGH",
+	EMCRegTachTargetLow:     "TACH_TARGET_LOW",
+	EMCRegTachTargetHigh:    "TACH_TARGET_HIGH",
+	EMCRegTachReadingHigh:   "TACH_READING_HIGH",
+	EMCRegTachReadingLow:    "TACH_READING_LOW",
+}
+
+// EMCRegisters returns the documented registers of an EMC2305 in ascending order.
+func EMCRegisters() []Register {
+	registers := slices.Collect(maps.Keys(emcRegisterNames))
+	for reg := range emcFanRegisterNames {
+		for channel := range uint8(EMCChannels) {
+			registers = append(registers, EMCFanRegister(reg, channel))
+		}
+	}
+
+	slices.Sort(registers)
+	return registers
+}
+
+// fanRegister returns the base register and the channel of a per channel register.
+func fanRegister(reg Register) (Register, uint8, bool) {
+	if reg < EMCRegFanSetting || reg >= EMCFanRegister(EMCRegFanSetting, EMCChannels) {
+		return 0, 0, false
+	}
+
+	base := EMCRegFanSetting + (reg-EMCRegFanSetting)%EMCChannelOffset
+	_, ok := emcFanRegisterNames[base]
+	return base, uint8((reg - EMCRegFanSetting) / EMCChannelOffset), ok
+}
+
+// EMCRegisterName returns the datasheet name of the register (e.g. FAN2_SETTING), empty when unknown.
+func EMCRegisterName(reg Register) string {
+	if name, ok := emcRegisterNames[reg]; ok {
+		return name
+	}
+
+	if base, channel, ok := fanRegister(reg); ok {
+		return fmt.Sprintf("FAN%d_%s", channel+1, emcFanRegisterNames[base])
+	}
+
+	return ""
+}
+
+// ParseEMCRegister parses a register name (e.g. FAN2_SETTING) or address (e.g. 0x40).
+func ParseEMCRegister(s string) (Register, error) {
+	for _, reg := range EMCRegisters() {
+		if strings.EqualFold(s, EMCRegisterName(reg)) {
+			return reg, nil
+		}
+	}
+
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid register %s", s)
+	}
+
+	return Register(v), nil
+}
+
+// DecodeEMCRegister returns the fields of a register value in a human readable form.
+func DecodeEMCRegister(reg Register, v uint8) []string {
+	bit := func(name string, n uint8) string {
+		return fmt.Sprintf("%s=%d", name, v>>n&1)
+	}
+	fans := func(name string) string {
+		var s []string
+		for channel := range uint8(EMCChannels) {
+			if v&(1<<channel) != 0 {
+				s = append(s, fmt.Sprintf("fan%d", channel+1))
+			}
+		}
+		return fmt.Sprintf("%s=[%s]", name, strings.Join(s, ","))
+	}
+	percent := func(name string) string {
+		return fmt.Sprintf("%s=%.1f%%", name, float64(v)*100/255)
+	}
+
+	switch reg {
+	case EMCRegConfiguration:
+		return []string{bit("mask", 7), bit("dis_to", 6), bit("wd_en", 5), bit("dreck", 1), bit("useck", 0)}
+	case EMCRegFanStatus:
+		return []string{bit("watch", 7), bit("drive_fail", 2), bit("fan_spin", 1), bit("fan_stall", 0)}
+	case EMCRegFanStallStatus:
+		return []string{fans("stalled")}
+	case EMCRegFanSpinStatus:
+		return []string{fans("spin_up_failed")}
+	case EMCRegDriveFailStatus:
+		return []string{fans("drive_failed")}
+	case EMCRegFanInterrupt:
+		return []string{fans("enabled")}
+	case EMCRegPWMPolarity:
+		return []string{fans("inverted")}
+	case EMCRegPWMOutputConfig:
+		return []string{fans("push_pull")}
+	case EMCRegPWMBaseFrequency1, EMCRegPWMBaseFrequency2:
+		var s []string
+		for channel := range uint8(EMCChannels) {
+			if pwmFrequencyRegister(channel) == reg {
+				s = append(s, fmt.Sprintf("fan%d=%s", channel+1, PWMFrequency(v>>pwmFrequencyShift(channel)&0b11)))
+			}
+		}
+		return s
+	case EMCRegSoftwareLock:
+		return []string{bit("lock", 0)}
+	}
+
+	base, _, ok := fanRegister(reg)
+	if !ok {
+		return nil
+	}
+
+	switch base {
+	case EMCRegFanSetting:
+		return []string{percent("drive")}
+	case EMCRegPWMDivide:
+		return []string{fmt.Sprintf("divide=%d", v)}
+	case EMCRegFanConfiguration:
+		return []string{
+			bit("en_algo", 7),
+			fmt.Sprintf("range=%drpm", rpmRanges[v>>5&0b11]),
+			fmt.Sprintf("edges=%d", edges[v>>3&0b11]),
+			fmt.Sprintf("update=%d", v&0b111),
+		}
+	case EMCRegSpinUpConfig:
+		return []string{
+			fmt.Sprintf("drive_fail_cnt=%d", v>>6),
+			fmt.Sprintf("kick=%d", ^v>>5&1),
+			fmt.Sprintf("level=%d%%", spinUpLevels[v>>2&0b111]),
+			fmt.Sprintf("time=%s", spinUpTimes[v&0b11]),
+		}
+	case EMCRegFanMinimumDrive:
+		return []string{percent("min_drive")}
+	}
+
+	return nil
+}
+
+// EMCChips returns the number of EMC2305 needed to drive the given number of channels.
+func EMCChips(channels int) int {
+	return (channels + EMCChannels - 1) / EMCChannels
+}
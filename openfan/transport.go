@@ -0,0 +1,16 @@
+package openfan
+
+import (
+	"io"
+	"time"
+)
+
+// A Transport carries the bytes exchanged with the device.
+// go.bug.st/serial ports implement it, as well as the TCP and RFC 2217 transports.
+type Transport interface {
+	io.ReadWriteCloser
+	// SetReadTimeout sets the duration after which Read returns 0 bytes and no error.
+	SetReadTimeout(t time.Duration) error
+	ResetInputBuffer() error
+	ResetOutputBuffer() error
+}
@@ -0,0 +1,234 @@
+package openfan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// Telnet (RFC 854) and COM Port Control Option (RFC 2217) codes.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptBinary  = 0
+	telnetOptSGA     = 3
+	telnetOptComPort = 44
+
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+	comPortSetControl  = 5
+	comPortPurgeData   = 12
+
+	comPortParityNone = 1
+	comPortStopSize1  = 1
+	comPortDTROn      = 8
+	comPortPurgeRx    = 1
+	comPortPurgeTx    = 2
+)
+
+type telnetState int
+
+const (
+	telnetData telnetState = iota
+	telnetCommand
+	telnetOption
+	telnetSubnegotiation
+	telnetSubnegotiationIAC
+)
+
+// A rfc2217Transport is a Telnet connection to a COM Port Control server (e.g. ser2net in telnet mode).
+// The Telnet commands are stripped from the received bytes and the data bytes are escaped.
+type rfc2217Transport struct {
+	tcp     *tcpTransport
+	state   telnetState
+	command byte
+	raw     []byte
+	pending []byte
+}
+
+func dialRFC2217(addr string, cfg DeviceConfig) (*rfc2217Transport, error) {
+	tcp, err := dialTCP(addr, cfg.ReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &rfc2217Transport{
+		tcp: tcp,
+		raw: make([]byte, CommRxBufferLenASCII),
+	}
+
+	var b bytes.Buffer
+	for _, negotiation := range [][2]byte{
+		{telnetWILL, telnetOptComPort},
+		{telnetWILL, telnetOptBinary},
+		{telnetDO, telnetOptBinary},
+		{telnetWILL, telnetOptSGA},
+		{telnetDO, telnetOptSGA},
+	} {
+		b.Write([]byte{telnetIAC, negotiation[0], negotiation[1]})
+	}
+
+	baudrate := binary.BigEndian.AppendUint32(nil, uint32(cfg.BaudRate))
+	b.Write(comPortCommand(comPortSetBaudRate, baudrate...))
+	b.Write(comPortCommand(comPortSetDataSize, 8))
+	b.Write(comPortCommand(comPortSetParity, comPortParityNone))
+	b.Write(comPortCommand(comPortSetStopSize, comPortStopSize1))
+	b.Write(comPortCommand(comPortSetControl, comPortDTROn)) // The firmware only talks to an opened CDC port
+
+	if _, err = tcp.Write(b.Bytes()); err != nil {
+		tcp.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func comPortCommand(command byte, value ...byte) []byte {
+	b := []byte{telnetIAC, telnetSB, telnetOptComPort, command}
+	for _, v := range value {
+		b = append(b, v)
+		if v == telnetIAC {
+			b = append(b, telnetIAC)
+		}
+	}
+	return append(b, telnetIAC, telnetSE)
+}
+
+func (t *rfc2217Transport) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		n, err := t.tcp.Read(t.raw)
+		if err != nil {
+			return 0, err
+		}
+
+		if err = t.decode(t.raw[:n]); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// decode appends the data bytes to the pending ones and answers the negotiations of the server.
+func (t *rfc2217Transport) decode(raw []byte) error {
+	var answer []byte
+
+	for _, c := range raw {
+		switch t.state {
+		case telnetData:
+			if c == telnetIAC {
+				t.state = telnetCommand
+				continue
+			}
+			t.pending = append(t.pending, c)
+		case telnetCommand:
+			switch c {
+			case telnetIAC:
+				t.pending = append(t.pending, c) // Escaped 0xFF
+				t.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.command = c
+				t.state = telnetOption
+			case telnetSB:
+				t.state = telnetSubnegotiation
+			default:
+				t.state = telnetData // NOP, GA, etc.
+			}
+		case telnetOption:
+			t.state = telnetData
+
+			supported := c == telnetOptBinary || c == telnetOptSGA || c == telnetOptComPort
+			if supported {
+				continue // Already requested
+			}
+
+			switch t.command {
+			case telnetDO:
+				answer = append(answer, telnetIAC, telnetWONT, c)
+			case telnetWILL:
+				answer = append(answer, telnetIAC, telnetDONT, c)
+			}
+		case telnetSubnegotiation:
+			// The notifications of the server (e.g. line or modem state) are ignored.
+			if c == telnetIAC {
+				t.state = telnetSubnegotiationIAC
+			}
+		case telnetSubnegotiationIAC:
+			t.state = telnetSubnegotiation
+			if c == telnetSE {
+				t.state = telnetData
+			}
+		}
+	}
+
+	if len(answer) == 0 {
+		return nil
+	}
+
+	_, err := t.tcp.Write(answer)
+	return err
+}
+
+func (t *rfc2217Transport) Write(p []byte) (int, error) {
+	escaped := bytes.ReplaceAll(p, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+	if _, err := t.tcp.Write(escaped); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (t *rfc2217Transport) SetReadTimeout(timeout time.Duration) error {
+	return t.tcp.SetReadTimeout(timeout)
+}
+
+// ResetInputBuffer purges the receive buffer of the server and discards the bytes already received.
+func (t *rfc2217Transport) ResetInputBuffer() error {
+	if _, err := t.tcp.Write(comPortCommand(comPortPurgeData, comPortPurgeRx)); err != nil {
+		return err
+	}
+
+	timeout := t.tcp.timeout
+	defer func() {
+		t.tcp.timeout = timeout
+	}()
+
+	t.tcp.timeout = time.Millisecond
+	for {
+		n, err := t.tcp.Read(t.raw)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		// Negotiations must still be processed.
+		if err = t.decode(t.raw[:n]); err != nil {
+			return err
+		}
+	}
+
+	t.pending = t.pending[:0]
+	return nil
+}
+
+// ResetOutputBuffer purges the transmit buffer of the server.
+func (t *rfc2217Transport) ResetOutputBuffer() error {
+	_, err := t.tcp.Write(comPortCommand(comPortPurgeData, comPortPurgeTx))
+	return err
+}
+
+func (t *rfc2217Transport) Close() error {
+	return t.tcp.Close()
+}
@@ -0,0 +1,114 @@
+package openfan
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 2 * time.Second
+)
+
+// openTransport opens the device behind the given port:
+//
+//	/dev/ttyACM0            a local serial device
+//	tcp://host:port         a raw TCP serial server (e.g. ser2net)
+//	rfc2217://host:port     a Telnet COM Port Control server (RFC 2217)
+func openTransport(port string, cfg DeviceConfig) (Transport, error) {
+	u, err := url.Parse(port)
+	if err != nil || u.Host == "" {
+		return openSerial(port, cfg)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		return dialTCP(u.Host, cfg.ReadTimeout)
+	case "rfc2217":
+		return dialRFC2217(u.Host, cfg)
+	}
+
+	return openSerial(port, cfg)
+}
+
+// A tcpTransport is a raw TCP connection to a serial server.
+type tcpTransport struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func dialTCP(addr string, timeout time.Duration) (*tcpTransport, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true)
+		tcp.SetKeepAlivePeriod(10 * time.Second) // Detect a dead server
+	}
+
+	return &tcpTransport{
+		conn:    conn,
+		timeout: timeout,
+	}, nil
+}
+
+// Read behaves like a serial port: it returns 0 bytes and no error on timeout.
+func (t *tcpTransport) Read(p []byte) (int, error) {
+	if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+		return 0, err
+	}
+
+	n, err := t.conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, nil
+	}
+
+	return n, err
+}
+
+func (t *tcpTransport) Write(p []byte) (int, error) {
+	if err := t.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return 0, err
+	}
+
+	return t.conn.Write(p)
+}
+
+func (t *tcpTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+// ResetInputBuffer discards the bytes already received.
+func (t *tcpTransport) ResetInputBuffer() error {
+	timeout := t.timeout
+	defer func() {
+		t.timeout = timeout
+	}()
+
+	t.timeout = time.Millisecond
+	buf := make([]byte, CommRxBufferLenASCII)
+	for {
+		n, err := t.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// ResetOutputBuffer is a no-op, the bytes are sent as soon as they are written.
+func (t *tcpTransport) ResetOutputBuffer() error {
+	return nil
+}
+
+func (t *tcpTransport) Close() error {
+	return t.conn.Close()
+}
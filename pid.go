@@ -0,0 +1,124 @@
+package openfand
+
+import (
+	"time"
+
+	"github.com/mdouchement/openfand/hwmon/sensor"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+// PIDShaper drives the fans with `controller: pid` to keep a temperature at its setpoint.
+// When such a fan also has curve points, the higher of both evaluations is applied.
+type PIDShaper struct {
+	shaper Shaper
+	now    func() time.Time
+	labels map[Channel]string
+	pids   map[Channel]*pid
+}
+
+func NewPIDShaper(cfg Config, shaper Shaper, now func() time.Time) *PIDShaper {
+	s := &PIDShaper{
+		shaper: shaper,
+		now:    now,
+		labels: make(map[Channel]string),
+		pids:   make(map[Channel]*pid),
+	}
+
+	for _, fan := range cfg.FanSettings {
+		if fan.Control != ControlPID {
+			continue
+		}
+
+		s.labels[fan.Channel()] = fan.Label
+		s.pids[fan.Channel()] = &pid{settings: fan.PID}
+	}
+
+	return s
+}
+
+func (s *PIDShaper) Eval(temps []sensor.Temperature) map[Channel]Evaluation {
+	evals := s.shaper.Eval(temps)
+
+	now := s.now()
+	for fid, pid := range s.pids {
+		for _, t := range temps {
+			if t.Name != pid.settings.Sensor {
+				continue
+			}
+
+			e := Evaluation{
+				Controller:      fid.Controller,
+				ID:              fid.Fan,
+				EvaluedAt:       now,
+				Label:           s.labels[fid],
+				Mode:            ModePWM,
+				PWM:             openfan.RoundPWM(pid.update(now, t.Temperature)),
+				TemperatureID:   t.ID,
+				TemperatureName: t.Name,
+				Temperature:     t.Temperature,
+			}
+
+			evals[fid] = maxPWM(evals[fid], e)
+			break
+		}
+	}
+
+	return evals
+}
+
+// A pid computes the PWM of a fan from the error between its temperature and the setpoint.
+type pid struct {
+	settings   *FanPID
+	updatedAt  time.Time
+	last       float64 // Last temperature
+	integral   float64
+	derivative float64 // Filtered derivative of the temperature
+}
+
+// update returns the PWM for the temperature t measured at now.
+func (p *pid) update(now time.Time, t float64) float64 {
+	s := p.settings
+	e := t - s.Setpoint // Positive when too hot
+
+	if p.updatedAt.IsZero() {
+		// No elapsed time yet, only the proportional term is known.
+		p.updatedAt = now
+		p.last = t
+		return clamp(s.Kp*e, s.min, s.max)
+	}
+
+	dt := now.Sub(p.updatedAt).Seconds()
+	if dt <= 0 {
+		return clamp(s.Kp*e+p.integral+s.Kd*p.derivative, s.min, s.max)
+	}
+
+	// The derivative is computed on the temperature so a setpoint change does not kick the output,
+	// and it is smoothed by a first-order low-pass filter.
+	raw := (t - p.last) / dt
+	alpha := 1.0
+	if tau := s.DerivativeFilter.Seconds(); tau > 0 {
+		alpha = dt / (tau + dt)
+	}
+	p.derivative += alpha * (raw - p.derivative)
+
+	p.updatedAt = now
+	p.last = t
+
+	// Anti-windup: the integral only grows until the output reaches its limit, it is never pushed by the limits
+	// so a null integral gain keeps a null integral.
+	pd := s.Kp*e + s.Kd*p.derivative
+	integral := p.integral + s.Ki*e*dt
+	switch {
+	case pd+integral > s.max && integral > p.integral:
+		integral = max(p.integral, s.max-pd)
+	case pd+integral < s.min && integral < p.integral:
+		integral = min(p.integral, s.min-pd)
+	}
+	p.integral = integral
+
+	return clamp(pd+integral, s.min, s.max)
+}
+
+func clamp(v, low, high float64) float64 {
+	return min(max(v, low), high)
+}
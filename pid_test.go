@@ -0,0 +1,193 @@
+package openfand
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/hwmon/sensor"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPIDFirstTick(t *testing.T) {
+	p := &pid{settings: &FanPID{Setpoint: 40, Kp: 8, Ki: 0.5, Kd: 4, min: 20, max: 100}}
+	now := time.Unix(0, 0)
+
+	// Only the proportional term, whatever the gains of the others.
+	if got := p.update(now, 45); got != 40 {
+		t.Errorf("got %.2f, want 40", got)
+	}
+	if p.integral != 0 || p.derivative != 0 {
+		t.Errorf("integral %.2f and derivative %.2f must not be computed without elapsed time", p.integral, p.derivative)
+	}
+
+	// Clamped on the output limits.
+	p = &pid{settings: &FanPID{Setpoint: 40, Kp: 8, min: 20, max: 100}}
+	if got := p.update(now, 39); got != 20 {
+		t.Errorf("got %.2f, want the min 20", got)
+	}
+}
+
+func TestPIDNoElapsedTime(t *testing.T) {
+	p := &pid{settings: &FanPID{Setpoint: 40, Kp: 8, Ki: 1, Kd: 4, max: 100}}
+	now := time.Unix(0, 0)
+
+	p.update(now, 42)
+	p.update(now.Add(time.Second), 44)
+	integral, derivative := p.integral, p.derivative
+
+	for _, at := range []time.Time{now.Add(time.Second), now} { // Same instant and clock going backward
+		want := 8*(46.0-40) + integral + 4*derivative
+		if got := p.update(at, 46); !near(got, want) {
+			t.Errorf("%s: got %.2f, want %.2f", at.Sub(now), got, want)
+		}
+		if p.integral != integral || p.derivative != derivative || p.last != 44 {
+			t.Errorf("%s: the state must not be updated", at.Sub(now))
+		}
+	}
+}
+
+func TestPIDAntiWindup(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	for name, tc := range map[string]struct {
+		saturated float64 // Temperature saturating the output
+		recovered float64
+		want      float64 // Output right after the saturation
+	}{
+		"max": {saturated: 60, recovered: 41, want: 10*1 + 1*1},
+		"min": {saturated: 20, recovered: 45, want: 10*5 + 1*5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &pid{settings: &FanPID{Setpoint: 40, Kp: 10, Ki: 1, max: 100}}
+
+			clk := now
+			for range 100 {
+				p.update(clk, tc.saturated)
+				clk = clk.Add(time.Second)
+			}
+			if p.integral != 0 {
+				t.Errorf("the integral must not wind up while saturated, got %.2f", p.integral)
+			}
+
+			if got := p.update(clk, tc.recovered); !near(got, tc.want) {
+				t.Errorf("got %.2f, want %.2f", got, tc.want)
+			}
+		})
+	}
+
+	// Without saturation, the integral is bounded by the output limits.
+	p := &pid{settings: &FanPID{Setpoint: 40, Ki: 10, min: 20, max: 80}}
+	clk := now
+	for range 20 {
+		p.update(clk, 45)
+		clk = clk.Add(time.Second)
+	}
+	if p.integral != 80 {
+		t.Errorf("integral: got %.2f, want the max 80", p.integral)
+	}
+}
+
+func TestPIDNoIntegralGain(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	for _, temperature := range []float64{42, 46} { // Below and above the min
+		p := &pid{settings: &FanPID{Setpoint: 40, Kp: 5, min: 20, max: 100}}
+		want := clamp(5*(temperature-40), 20, 100)
+
+		for i := range 5 {
+			if got := p.update(now.Add(time.Duration(i)*time.Second), temperature); got != want {
+				t.Errorf("%.0f°C: tick %d: got %.2f, want %.2f", temperature, i, got, want)
+			}
+		}
+		if p.integral != 0 {
+			t.Errorf("%.0f°C: the integral must stay null without integral gain, got %.2f", temperature, p.integral)
+		}
+	}
+}
+
+func TestPIDDerivativeFilter(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	for name, tc := range map[string]struct {
+		filter time.Duration
+		want   []float64
+	}{
+		"unfiltered": {want: []float64{4, 0, 0}},
+		"filtered":   {filter: 3 * time.Second, want: []float64{1, 0.75, 0.5625}}, // alpha = 1s / (3s + 1s)
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &pid{settings: &FanPID{Setpoint: 40, Kd: 1, max: 100, DerivativeFilter: Duration{Duration: tc.filter}}}
+			p.update(now, 40)
+
+			// A step of 4°C then a steady temperature.
+			for i, want := range tc.want {
+				got := p.update(now.Add(time.Duration(i+1)*time.Second), 44)
+				if !near(got, want) || !near(p.derivative, want) {
+					t.Errorf("tick %d: got %.4f (derivative %.4f), want %.4f", i+1, got, p.derivative, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPIDShaper(t *testing.T) {
+	cfg := loadConfig(t, `
+fan_settings:
+  fan1:
+    controller: pid
+    pid:
+      sensor: cpu
+      setpoint: 40
+      kp: 10
+    curve_points:
+      - 20%:
+          cpu: 30
+      - 80%:
+          cpu: 60
+  fan2:
+    controller: pid
+    pid:
+      sensor: gpu
+      setpoint: 40
+      kp: 10
+`)
+	curves, err := NewCurveShaper(cfg, []sensor.Temperature{cpu, gpu})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := time.Unix(0, 0)
+	s := NewPIDShaper(cfg, curves, func() time.Time { return clk })
+
+	both := Channel{Controller: DefaultController, Fan: 0}
+	only := Channel{Controller: DefaultController, Fan: 1}
+
+	for i, step := range []struct {
+		cpu, gpu float64
+		both     float64
+		only     float64
+	}{
+		{cpu: 35, gpu: 35, both: curvePWM(35), only: 0}, // Below the setpoint, the curve wins
+		{cpu: 45, gpu: 45, both: 50, only: 50},          // The PID wins
+		{cpu: 55, gpu: 50, both: 100, only: 100},
+		{cpu: 42, gpu: 41, both: curvePWM(42), only: 10}, // The curve wins again
+	} {
+		clk = clk.Add(time.Second)
+		evals := s.Eval([]sensor.Temperature{at(cpu, step.cpu)[0], at(gpu, step.gpu)[0]})
+
+		if got := evals[both].PWM; got != openfan.RoundPWM(step.both) {
+			t.Errorf("step %d: fan with a curve: got PWM %.1f, want %.1f", i, got, openfan.RoundPWM(step.both))
+		}
+		if got := evals[only].PWM; got != openfan.RoundPWM(step.only) {
+			t.Errorf("step %d: fan without curve: got PWM %.1f, want %.1f", i, got, openfan.RoundPWM(step.only))
+		}
+		if got := evals[only].EvaluedAt; !got.Equal(clk) {
+			t.Errorf("step %d: evaluated at %s, want the injected clock %s", i, got, clk)
+		}
+	}
+}
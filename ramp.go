@@ -0,0 +1,53 @@
+package openfand
+
+import (
+	"math"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+)
+
+// A rampStep is the last intermediate PWM written on the way to a ramp target.
+type rampStep struct {
+	at time.Time
+	up bool
+}
+
+// ramping returns true when the fan is ramping toward a target in the same direction as diff.
+func (c *Controller) ramping(fid Channel, diff float64) bool {
+	step, ok := c.ramps[fid]
+	return ok && step.up == (diff > 0)
+}
+
+// ramp returns the evaluation to write on the way from the active evaluation to eval according to the ramp rates of the fan.
+// The PWM moves at most of the rate for the elapsed time since the previous step, the target being reached over several ticks.
+func (c *Controller) ramp(fid Channel, eval, active Evaluation) Evaluation {
+	up := eval.PWM > active.PWM
+	rate := c.fans[fid].rampDown
+	if up {
+		rate = c.fans[fid].rampUp
+	}
+	if eval.Mode != ModePWM || rate == 0 {
+		return eval
+	}
+
+	elapsed := c.polling // A new ramp starts with one tick
+	if c.ramping(fid, eval.PWM-active.PWM) {
+		elapsed = c.now().Sub(c.ramps[fid].at)
+	}
+
+	delta := max(rate*elapsed.Seconds(), 100.0/math.MaxUint8) // At least one duty to make progress
+	if math.Abs(eval.PWM-active.PWM) <= delta {
+		return eval
+	}
+
+	eval.RampTarget = ToPtr(eval.PWM)
+	eval.Stopped = "" // Not yet
+	if up {
+		eval.PWM = openfan.RoundPWM(active.PWM + delta)
+	} else {
+		eval.PWM = openfan.RoundPWM(active.PWM - delta)
+	}
+
+	return eval
+}
@@ -0,0 +1,94 @@
+package openfand
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+)
+
+func TestRamp(t *testing.T) {
+	up := func(pwm float64) float64 { return openfan.RoundPWM(pwm + 10) } // One tick at 10%/s
+	boost := openfan.RoundPWM(60)
+
+	type step struct {
+		at      int // Seconds
+		pwm     float64
+		rpm     uint16
+		written []float64
+		target  float64 // RampTarget of the applied evaluation, 0 without ramp
+	}
+
+	w1 := up(20)
+	w2 := up(w1)
+	w3 := up(w2)
+
+	for name, tc := range map[string]struct {
+		fan   Fan
+		steps []step
+	}{
+		"target moves": {fan: Fan{rampUp: 10}, steps: []step{
+			{at: 0, pwm: 20, written: []float64{20}},
+			{at: 1, pwm: 60, written: []float64{20, w1}, target: 60},
+			{at: 2, pwm: 60, written: []float64{20, w1, w2}, target: 60},
+			{at: 3, pwm: 80, written: []float64{20, w1, w2, w3}, target: 80}, // Same slope toward the new target
+			{at: 4, pwm: 45, written: []float64{20, w1, w2, w3, 45}},         // Reversed without ramp_down
+		}},
+		"slope": {fan: Fan{rampUp: 10}, steps: []step{
+			{at: 0, pwm: 20, written: []float64{20}},
+			{at: 1, pwm: 60, written: []float64{20, w1}, target: 60},
+			{at: 3, pwm: 60, written: []float64{20, w1, openfan.RoundPWM(w1 + 20)}, target: 60}, // 2s since the previous step
+			{at: 4, pwm: 60, written: []float64{20, w1, openfan.RoundPWM(w1 + 20), 60}},
+		}},
+		"step delay": {fan: Fan{rampUp: 10, FanSetUp: Duration{Duration: 2 * time.Second}}, steps: []step{
+			{at: 0, pwm: 20, written: []float64{20}},
+			{at: 1, pwm: 60, written: []float64{20}}, // Pending
+			{at: 2, pwm: 60, written: []float64{20}},
+			{at: 3, pwm: 60, written: []float64{20, w1}, target: 60},     // Delay reached, the ramp starts
+			{at: 4, pwm: 60, written: []float64{20, w1, w2}, target: 60}, // The ramp in progress is not delayed again
+			{at: 5, pwm: 60, written: []float64{20, w1, w2, w3}, target: 60},
+			{at: 6, pwm: 60, written: []float64{20, w1, w2, w3, 60}},
+		}},
+		"kick": {fan: Fan{rampUp: 10, SpinUp: &FanSpinUp{Boost: "60%", Duration: Duration{Duration: 2 * time.Second}}}, steps: []step{
+			{at: 0, pwm: 0, written: []float64{0}},
+			{at: 1, pwm: 40, written: []float64{0, boost}}, // The first ramp step is replaced by the boost
+			{at: 3, pwm: 40, rpm: 800, written: []float64{0, boost, 40}},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fan := tc.fan
+			fan.Controller = DefaultController
+			fan.Mode = ModePWM
+			if fan.SpinUp != nil {
+				if err := fan.SpinUp.parse(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			clk := &clock{}
+			c, rec, tick := evaluator(t, clk, fan)
+
+			for i, step := range tc.steps {
+				clk.Set(step.at)
+				c.sync.Lock()
+				c.rpms[fan.Channel()] = step.rpm
+				c.sync.Unlock()
+
+				tick(Evaluation{Controller: fan.Controller, ID: fan.ID, Mode: ModePWM, PWM: step.pwm, EvaluedAt: clk.Now()})
+
+				if got := rec.written(fan.ID); !slices.Equal(got, step.written) {
+					t.Fatalf("step %d: %.0f%% at %ds: got writes %v, want %v", i, step.pwm, step.at, got, step.written)
+				}
+
+				var target float64
+				if rt := c.applied[fan.Channel()].RampTarget; rt != nil {
+					target = *rt
+				}
+				if _, ok := c.ramps[fan.Channel()]; target != step.target || ok != (step.target > 0) {
+					t.Errorf("step %d: %.0f%% at %ds: got ramp target %.0f (ramping %v), want %.0f", i, step.pwm, step.at, target, ok, step.target)
+				}
+			}
+		})
+	}
+}
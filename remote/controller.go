@@ -0,0 +1,267 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+)
+
+var ErrStatus = errors.New("unexpected HTTP status")
+
+// Default endpoints of the OpenFan API.
+// `{fan}` is replaced by the zero-based fan index and `{value}` by the PWM in percent or the RPM.
+const (
+	DefaultRPMsPath = "/api/v0/fan/status"
+	DefaultPWMPath  = "/api/v0/fan/{fan}/pwm?value={value}"
+	DefaultRPMPath  = "/api/v0/fan/{fan}/rpm?value={value}"
+)
+
+type Options struct {
+	// URL is the base URL of the fan controller (e.g. http://10.0.0.5:3000).
+	URL string
+	// Channels is the number of fans, read from the RPMs endpoint when not set.
+	Channels int
+	// Timeout of each request (default 2s).
+	Timeout time.Duration
+	// Retries is the number of retries of a failed request (network error or 5xx).
+	Retries int
+	// Headers are sent along each request (e.g. Authorization), environment variables are expanded.
+	Headers  map[string]string
+	RPMsPath string
+	PWMPath  string
+	RPMPath  string
+}
+
+// A Controller drives the fans of a network fan controller through its HTTP API.
+// All requests are GET requests, the RPMs are read from a JSON object mapping the fan index to its RPM:
+//
+//	{"0": 1200, "1": 850}
+//	{"status": "ok", "data": {"0": 1200, "1": 850}}
+type Controller struct {
+	sync     sync.Mutex
+	client   *http.Client
+	base     *url.URL
+	opts     Options
+	headers  http.Header
+	channels int
+}
+
+func New(opts Options) (*Controller, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("%s: unsupported scheme", opts.URL)
+	}
+	if opts.Channels < 0 {
+		return nil, fmt.Errorf("invalid number of channels %d", opts.Channels)
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.RPMsPath == "" {
+		opts.RPMsPath = DefaultRPMsPath
+	}
+	if opts.PWMPath == "" {
+		opts.PWMPath = DefaultPWMPath
+	}
+	if opts.RPMPath == "" {
+		opts.RPMPath = DefaultRPMPath
+	}
+
+	headers := http.Header{}
+	for k, v := range opts.Headers {
+		headers.Set(k, os.ExpandEnv(v))
+	}
+
+	return &Controller{
+		client:   &http.Client{Timeout: opts.Timeout},
+		base:     base,
+		opts:     opts,
+		headers:  headers,
+		channels: opts.Channels,
+	}, nil
+}
+
+func (c *Controller) Port() string {
+	return c.base.Redacted()
+}
+
+// Channels returns the configured number of channels.
+// When not configured, it is the highest fan index reported by the RPMs endpoint.
+func (c *Controller) Channels() (int, error) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	if c.channels > 0 {
+		return c.channels, nil
+	}
+
+	rpms, err := c.rpms()
+	if err != nil {
+		return 0, fmt.Errorf("channels: %w", err)
+	}
+	if len(rpms) == 0 {
+		return 0, errors.New("channels: no fan reported by the controller")
+	}
+
+	c.channels = int(slices.Max(slices.Collect(maps.Keys(rpms)))) + 1
+	return c.channels, nil
+}
+
+func (c *Controller) RPMs() (map[openfan.Fan]uint16, error) {
+	n, err := c.Channels()
+	if err != nil {
+		return nil, err
+	}
+
+	rpms, err := c.rpms()
+	if err != nil {
+		return nil, fmt.Errorf("rpms: %w", err)
+	}
+
+	maps.DeleteFunc(rpms, func(f openfan.Fan, _ uint16) bool {
+		return int(f) >= n
+	})
+	return rpms, nil
+}
+
+// rpms returns all the fans reported by the RPMs endpoint.
+func (c *Controller) rpms() (map[openfan.Fan]uint16, error) {
+	body, err := c.get(c.opts.RPMsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Data map[string]uint16 `json:"data"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil || payload.Data == nil {
+		// Not wrapped in a data field.
+		if err = json.Unmarshal(body, &payload.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	rpms := make(map[openfan.Fan]uint16, len(payload.Data))
+	for k, rpm := range payload.Data {
+		i, err := strconv.ParseUint(k, 10, 8)
+		if err != nil {
+			continue // Not a fan
+		}
+
+		rpms[openfan.Fan(i)] = rpm
+	}
+
+	return rpms, nil
+}
+
+// SetPWM sets the PWM rounded to the percent, the resolution of the API.
+func (c *Controller) SetPWM(f openfan.Fan, pwm float64) (float64, error) {
+	if pwm < 0 || pwm > 100 {
+		return 0, openfan.ErrInvalidPWM
+	}
+
+	v := int(math.Round(pwm))
+	_, err := c.get(expand(c.opts.PWMPath, f, v))
+	if err != nil {
+		return 0, fmt.Errorf("set_pwm: %w", err)
+	}
+
+	return float64(v), nil
+}
+
+func (c *Controller) SetRPM(f openfan.Fan, rpm uint16) (uint16, error) {
+	_, err := c.get(expand(c.opts.RPMPath, f, int(rpm)))
+	if err != nil {
+		return 0, fmt.Errorf("set_rpm: %w", err)
+	}
+
+	return rpm, nil
+}
+
+// get requests the given path and retries with a backoff on network errors and server errors.
+func (c *Controller) get(path string) ([]byte, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u := c.base.JoinPath(ref.Path)
+	u.RawQuery = ref.RawQuery
+
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		body, err := c.do(u.String())
+		if err == nil || i >= c.opts.Retries || !retryable(err) {
+			return body, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (c *Controller) do(u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.headers.Clone()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+
+	return body, nil
+}
+
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.code, http.StatusText(e.code), e.body)
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrStatus
+}
+
+func retryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.code >= 500
+	}
+	return true // Network error
+}
+
+func expand(path string, f openfan.Fan, v int) string {
+	return strings.NewReplacer("{fan}", strconv.Itoa(int(f)), "{value}", strconv.Itoa(v)).Replace(path)
+}
@@ -0,0 +1,202 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mdouchement/openfand/openfan"
+	"github.com/mdouchement/openfand/remote"
+)
+
+// A server records the requests of a Controller.
+type server struct {
+	sync     sync.Mutex
+	requests []string
+	headers  []http.Header
+}
+
+func (s *server) record(r *http.Request) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	s.requests = append(s.requests, r.URL.RequestURI())
+	s.headers = append(s.headers, r.Header.Clone())
+}
+
+func (s *server) count() int {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	return len(s.requests)
+}
+
+func serve(t *testing.T, handler http.HandlerFunc) (*server, string) {
+	t.Helper()
+
+	s := &server{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("got %s request, want GET", r.Method)
+		}
+
+		s.record(r)
+		handler(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	return s, ts.URL
+}
+
+func TestEndpoints(t *testing.T) {
+	s, u := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openfan"+remote.DefaultRPMsPath {
+			w.Write([]byte(`{"status": "ok", "data": {"0": 1200, "1": 850, "7": 300}}`))
+		}
+	})
+
+	c, err := remote.New(remote.Options{URL: u + "/openfan", Channels: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpms, err := c.RPMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpms) != 2 || rpms[0] != 1200 || rpms[1] != 850 {
+		t.Errorf("got %v, want the fans below the configured channels", rpms)
+	}
+
+	pwm, err := c.SetPWM(2, 42.6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwm != 43 {
+		t.Errorf("applied PWM: got %.2f, want 43", pwm)
+	}
+
+	rpm, err := c.SetRPM(3, 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpm != 1500 {
+		t.Errorf("applied RPM: got %d, want 1500", rpm)
+	}
+
+	if _, err = c.SetPWM(2, 101); !errors.Is(err, openfan.ErrInvalidPWM) {
+		t.Errorf("got %v, want %v", err, openfan.ErrInvalidPWM)
+	}
+
+	want := []string{
+		"/openfan/api/v0/fan/status",
+		"/openfan/api/v0/fan/2/pwm?value=43",
+		"/openfan/api/v0/fan/3/rpm?value=1500",
+	}
+	if len(s.requests) != len(want) {
+		t.Fatalf("got requests %v, want %v", s.requests, want)
+	}
+	for i := range want {
+		if s.requests[i] != want[i] {
+			t.Errorf("request %d: got %s, want %s", i, s.requests[i], want[i])
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	_, u := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"0": 1200, "4": 850, "temperature": 40}`))
+	})
+
+	c, err := remote.New(remote.Options{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.Channels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("got %d channels, want 5", n)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for name, tc := range map[string]struct {
+		code     int
+		requests int
+	}{
+		"server error": {code: http.StatusBadGateway, requests: 3},
+		"client error": {code: http.StatusUnauthorized, requests: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, u := serve(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tc.code)
+			})
+
+			c, err := remote.New(remote.Options{URL: u, Channels: 1, Retries: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = c.SetPWM(0, 50); !errors.Is(err, remote.ErrStatus) {
+				t.Errorf("got %v, want %v", err, remote.ErrStatus)
+			}
+			if s.count() != tc.requests {
+				t.Errorf("got %d requests, want %d", s.count(), tc.requests)
+			}
+		})
+	}
+
+	// A transient failure is retried until it succeeds.
+	var failures int
+	s, u := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if failures < 1 {
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	c, err := remote.New(remote.Options{URL: u, Channels: 1, Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.SetPWM(0, 50); err != nil {
+		t.Fatal(err)
+	}
+	if s.count() != 2 {
+		t.Errorf("got %d requests, want 2", s.count())
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	t.Setenv("OPENFAN_TOKEN", "s3cr3t")
+
+	s, u := serve(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	c, err := remote.New(remote.Options{
+		URL:      u,
+		Channels: 1,
+		Headers: map[string]string{
+			"Authorization": "Bearer ${OPENFAN_TOKEN}",
+			"X-Rack":        "top",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.SetPWM(0, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.headers[0].Get("Authorization"); got != "Bearer s3cr3t" {
+		t.Errorf("Authorization: got %q, want the expanded token", got)
+	}
+	if got := s.headers[0].Get("X-Rack"); got != "top" {
+		t.Errorf("X-Rack: got %q, want top", got)
+	}
+}
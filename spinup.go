@@ -0,0 +1,77 @@
+package openfand
+
+import (
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/openfand/openfan"
+)
+
+// spinUpAttempts is the number of boost durations awaited for the fan to start before settling anyway.
+const spinUpAttempts = 3
+
+// A kickStart is a spin-up boost in progress.
+type kickStart struct {
+	since    time.Time
+	attempts int
+	failed   bool // The fan did not start, it is not kicked again until it spins or stops
+}
+
+// kickStart returns the boost evaluation to write instead of eval when the fan leaves a standstill for a low PWM.
+func (c *Controller) kickStart(fid Channel, eval, active Evaluation, hasActive bool, calibrations map[Channel]Calibration) (Evaluation, bool) {
+	spinUp := c.fans[fid].SpinUp
+	if spinUp == nil || eval.Mode != ModePWM || eval.PWM == 0 || eval.PWM >= spinUp.boost {
+		return eval, false
+	}
+
+	if kick, ok := c.kicks[fid]; ok && kick.failed {
+		if active.RPM == 0 && active.PWM > 0 {
+			return eval, false
+		}
+		delete(c.kicks, fid)
+	}
+
+	below := spinUp.below
+	if cal, ok := calibrations[fid]; ok && below == 0 {
+		below = cal.MinStart
+	}
+
+	stopped := !hasActive || active.PWM == 0 || active.PWM < below || active.RPM == 0
+	if !stopped {
+		return eval, false
+	}
+
+	eval.PWM = openfan.RoundPWM(spinUp.boost)
+	eval.RampTarget = nil // The ramp, if any, starts over from the boost
+	return eval, true
+}
+
+// spinningUp returns true while the spin-up boost of the fan is in progress.
+// The boost lasts until the fan is confirmed spinning by its RPM, then the fan is settled on its evaluated PWM.
+func (c *Controller) spinningUp(log logger.Logger, fid Channel, rpm uint16) bool {
+	kick, ok := c.kicks[fid]
+	if !ok || kick.failed {
+		return false
+	}
+
+	if c.now().Sub(kick.since) < c.fans[fid].SpinUp.Duration.Duration {
+		return true
+	}
+
+	if rpm == 0 && kick.attempts < spinUpAttempts {
+		kick.attempts++
+		kick.since = c.now()
+		c.kicks[fid] = kick
+		log.Warnf("Fan %s(%s) did not start yet, extending its spin-up", fid, c.fans[fid].Label)
+		return true
+	}
+
+	delete(c.kicks, fid)
+	if rpm == 0 {
+		log.Warnf("Fan %s(%s) did not start after its spin-up", fid, c.fans[fid].Label)
+		c.kicks[fid] = kickStart{failed: true}
+	}
+
+	c.forced[fid] = true // Settle right away
+	return false
+}
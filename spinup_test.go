@@ -0,0 +1,73 @@
+package openfand
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/openfan"
+)
+
+func TestSpinUp(t *testing.T) {
+	boost := openfan.RoundPWM(60)
+
+	type step struct {
+		at      int // Seconds
+		rpm     uint16
+		written []float64
+	}
+
+	for name, tc := range map[string]struct {
+		steps  []step
+		failed bool
+	}{
+		"started": {steps: []step{
+			{at: 0, written: []float64{boost}}, // Kicked from a standstill
+			{at: 1, rpm: 800, written: []float64{boost}},
+			{at: 2, rpm: 800, written: []float64{boost, 30}}, // Boost duration elapsed, settled on the evaluated PWM
+			{at: 3, rpm: 800, written: []float64{boost, 30}},
+		}},
+		"late start": {steps: []step{
+			{at: 0, written: []float64{boost}},
+			{at: 2, written: []float64{boost}}, // Not spinning yet, extended
+			{at: 3, rpm: 800, written: []float64{boost}},
+			{at: 4, rpm: 800, written: []float64{boost, 30}}, // Extended by one boost duration
+		}},
+		"failed": {failed: true, steps: []step{
+			{at: 0, written: []float64{boost}},
+			{at: 2, written: []float64{boost}},
+			{at: 4, written: []float64{boost}},
+			{at: 6, written: []float64{boost}},     // Last attempt
+			{at: 8, written: []float64{boost, 30}}, // Settled anyway
+			{at: 9, written: []float64{boost, 30}}, // Not kicked again while it does not spin
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			spinUp := &FanSpinUp{Boost: "60%", Duration: Duration{Duration: 2 * time.Second}}
+			if err := spinUp.parse(); err != nil {
+				t.Fatal(err)
+			}
+			fan := Fan{Controller: DefaultController, ID: 0, Mode: ModePWM, SpinUp: spinUp}
+
+			clk := &clock{}
+			c, rec, tick := evaluator(t, clk, fan)
+
+			for i, step := range tc.steps {
+				clk.Set(step.at)
+				c.sync.Lock()
+				c.rpms[fan.Channel()] = step.rpm
+				c.sync.Unlock()
+
+				tick(Evaluation{Controller: fan.Controller, ID: fan.ID, Mode: ModePWM, PWM: 30, EvaluedAt: clk.Now()})
+
+				if got := rec.written(fan.ID); !slices.Equal(got, step.written) {
+					t.Fatalf("step %d: %ds at %d RPM: got writes %v, want %v", i, step.at, step.rpm, got, step.written)
+				}
+			}
+
+			if kick, ok := c.kicks[fan.Channel()]; ok != tc.failed || kick.failed != tc.failed {
+				t.Errorf("got kick %+v, want failed %v", kick, tc.failed)
+			}
+		})
+	}
+}
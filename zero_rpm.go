@@ -0,0 +1,121 @@
+package openfand
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mdouchement/openfand/hwmon/sensor"
+)
+
+// ZeroRPMShaper stops the fans which zero_rpm settings are met.
+// The gap between the stop and start temperatures along with the minimum off and on times prevent the fans from toggling.
+type ZeroRPMShaper struct {
+	shaper   Shaper
+	now      func() time.Time
+	settings map[Channel]*FanZeroRPM
+	sensors  map[Channel][]string
+	states   map[Channel]*zeroRPM
+}
+
+type zeroRPM struct {
+	stopped bool
+	since   time.Time // Last stop or start
+	reason  string
+}
+
+func NewZeroRPMShaper(cfg Config, shaper Shaper, now func() time.Time) *ZeroRPMShaper {
+	s := &ZeroRPMShaper{
+		shaper:   shaper,
+		now:      now,
+		settings: make(map[Channel]*FanZeroRPM),
+		sensors:  make(map[Channel][]string),
+		states:   make(map[Channel]*zeroRPM),
+	}
+
+	for _, fan := range cfg.FanSettings {
+		if fan.ZeroRPM == nil {
+			continue
+		}
+
+		names := map[string]bool{}
+		if fan.PID != nil {
+			names[fan.PID.Sensor] = true
+			s.sensors[fan.Channel()] = append(s.sensors[fan.Channel()], fan.PID.Sensor)
+		}
+		for _, point := range fan.CurvePoints {
+			for _, thresholds := range point {
+				for name := range thresholds {
+					if !names[name] {
+						names[name] = true
+						s.sensors[fan.Channel()] = append(s.sensors[fan.Channel()], name)
+					}
+				}
+			}
+		}
+
+		s.settings[fan.Channel()] = fan.ZeroRPM
+		s.states[fan.Channel()] = &zeroRPM{} // Running since ever, it can be stopped right away
+	}
+
+	return s
+}
+
+func (s *ZeroRPMShaper) Eval(temps []sensor.Temperature) map[Channel]Evaluation {
+	evals := s.shaper.Eval(temps)
+
+	values := map[string]sensor.Temperature{}
+	for _, t := range temps {
+		values[t.Name] = t
+	}
+
+	now := s.now()
+	for fid, eval := range evals {
+		if settings, ok := s.settings[fid]; ok {
+			eval = s.zeroRPM(now, fid, settings, values, eval)
+		}
+		if eval.Stopped == "" && eval.Target() == 0 {
+			eval.Stopped = fmt.Sprintf("curve at %.1f°C on %s", eval.Temperature, eval.TemperatureName)
+		}
+
+		evals[fid] = eval
+	}
+
+	return evals
+}
+
+// zeroRPM updates the zero RPM state of the fan and returns its evaluation.
+func (s *ZeroRPMShaper) zeroRPM(now time.Time, fid Channel, settings *FanZeroRPM, values map[string]sensor.Temperature, eval Evaluation) Evaluation {
+	// The hottest temperature of the fan decides.
+	var hottest *sensor.Temperature
+	for _, name := range s.sensors[fid] {
+		if t, ok := values[name]; ok && (hottest == nil || t.Temperature > hottest.Temperature) {
+			hottest = &t
+		}
+	}
+	if hottest == nil {
+		return eval
+	}
+	t := hottest.Temperature
+
+	state := s.states[fid]
+	switch {
+	case !state.stopped && t < settings.StopBelow && now.Sub(state.since) >= settings.MinOn.Duration:
+		state.stopped = true
+		state.since = now
+		state.reason = fmt.Sprintf("zero rpm, %.1f°C on %s below %g°C", t, hottest.Name, settings.StopBelow)
+	case state.stopped && t > settings.StartAbove && now.Sub(state.since) >= settings.MinOff.Duration:
+		state.stopped = false
+		state.since = now
+	}
+
+	if state.stopped {
+		eval.PWM = 0
+		eval.TargetRPM = 0
+		eval.TemperatureID = hottest.ID
+		eval.TemperatureName = hottest.Name
+		eval.Temperature = t
+		eval.Stopped = state.reason
+	}
+
+	return eval
+}
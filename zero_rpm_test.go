@@ -0,0 +1,76 @@
+package openfand
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/openfand/hwmon/sensor"
+)
+
+func TestZeroRPM(t *testing.T) {
+	cfg := loadConfig(t, `
+fan_settings:
+  fan1:
+    zero_rpm:
+      stop_below: 40
+      start_above: 45
+      min_off: 30s
+      min_on: 1m
+    curve_points: &curve
+      - 20%:
+          cpu: 30
+          gpu: 30
+      - 80%:
+          cpu: 60
+          gpu: 60
+  fan2:
+    curve_points: *curve
+`)
+	curves, err := NewCurveShaper(cfg, []sensor.Temperature{cpu, gpu})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := time.Unix(0, 0)
+	s := NewZeroRPMShaper(cfg, curves, func() time.Time { return clk })
+
+	fid := Channel{Controller: DefaultController, Fan: 0}
+	other := Channel{Controller: DefaultController, Fan: 1}
+
+	for i, step := range []struct {
+		at       int // Seconds
+		cpu, gpu float64
+		stopped  string
+	}{
+		{at: 0, cpu: 35, gpu: 38, stopped: "zero rpm, 38.0°C on gpu below 40°C"},  // Every temperature below stop_below
+		{at: 10, cpu: 35, gpu: 46, stopped: "zero rpm, 38.0°C on gpu below 40°C"}, // Within min_off
+		{at: 20, cpu: 35, gpu: 44, stopped: "zero rpm, 38.0°C on gpu below 40°C"},
+		{at: 30, cpu: 45, gpu: 44, stopped: "zero rpm, 38.0°C on gpu below 40°C"}, // Not above start_above
+		{at: 31, cpu: 46, gpu: 44},
+		{at: 40, cpu: 42, gpu: 44}, // Not below stop_below
+		{at: 50, cpu: 35, gpu: 38}, // Within min_on
+		{at: 91, cpu: 35, gpu: 39, stopped: "zero rpm, 39.0°C on gpu below 40°C"},
+		{at: 92, cpu: 35, gpu: 43, stopped: "zero rpm, 39.0°C on gpu below 40°C"}, // Between the stop and start temperatures
+	} {
+		clk = time.Unix(int64(step.at), 0)
+		evals := s.Eval([]sensor.Temperature{at(cpu, step.cpu)[0], at(gpu, step.gpu)[0]})
+		eval := evals[fid]
+
+		if eval.Stopped != step.stopped {
+			t.Errorf("step %d: %ds: got stopped %q, want %q", i, step.at, eval.Stopped, step.stopped)
+		}
+		hottest := gpu.Name
+		if step.cpu > step.gpu {
+			hottest = cpu.Name
+		}
+		if step.stopped != "" && (eval.PWM != 0 || eval.TemperatureName != hottest) {
+			t.Errorf("step %d: %ds: got PWM %.1f on %s, want a stop on the hottest temperature", i, step.at, eval.PWM, eval.TemperatureName)
+		}
+		if step.stopped == "" && eval.PWM != evals[other].PWM {
+			t.Errorf("step %d: %ds: got PWM %.1f, want the curve PWM %.1f", i, step.at, eval.PWM, evals[other].PWM)
+		}
+		if evals[other].Stopped != "" {
+			t.Errorf("step %d: %ds: the fan without zero_rpm should not stop", i, step.at)
+		}
+	}
+}